@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"os"
 	"os/signal"
@@ -18,7 +19,7 @@ func main() {
 		log.Fatal(err)
 	}
 	task1, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
-		return `"task1 success"`, nil
+		return json.RawMessage(`"task1 success"`), nil
 	}))
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,230 @@
+package lambdag
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// asciiNode is the task drawn in the row of the layer,
+// or the dummy node which passes the edge across the layer, drawn as the vertical line.
+type asciiNode struct {
+	task        *Task
+	label       string
+	start       int
+	downstreams []*asciiNode
+	upstreams   []*asciiNode
+}
+
+func (node *asciiNode) width() int {
+	return utf8.RuneCountInString(node.label)
+}
+
+func (node *asciiNode) center() int {
+	return node.start + node.width()/2
+}
+
+// renderASCII draws the tasks layer by layer from top to bottom, and the edges between them.
+// The edge across the layers passes through the layers as the vertical line.
+func renderASCII(w io.Writer, dag *DAG, opts RenderOptions) error {
+	rows, err := asciiRows(dag, opts)
+	if err != nil {
+		return err
+	}
+	var builder strings.Builder
+	builder.WriteString(dag.ID())
+	builder.WriteRune('\n')
+	for i, row := range rows {
+		canvas := &asciiCanvas{}
+		for _, node := range row {
+			canvas.write(node.start, node.label)
+		}
+		builder.WriteString(canvas.String())
+		if i+1 < len(rows) {
+			builder.WriteString(asciiEdges(row))
+		}
+	}
+	_, err = io.WriteString(w, builder.String())
+	return err
+}
+
+// asciiRows places the nodes of each layer, the node is placed under the average position of its upstream nodes if possible.
+func asciiRows(dag *DAG, opts RenderOptions) ([][]*asciiNode, error) {
+	tasksByLayer := opts.taskLayers(dag)
+	rows := make([][]*asciiNode, len(tasksByLayer))
+	nodes := make(map[string]*asciiNode)
+	layers := make(map[string]int)
+	for i, tasks := range tasksByLayer {
+		for _, task := range tasks {
+			label := "[" + task.ID()
+			if state, ok := opts.TaskStates[task.ID()]; ok {
+				label += ": " + string(state)
+			}
+			label += "]"
+			node := &asciiNode{task: task, label: label}
+			nodes[task.ID()] = node
+			layers[task.ID()] = i
+			rows[i] = append(rows[i], node)
+		}
+	}
+	if err := opts.WarkDependencies(dag, func(ancestor, descendant *Task) error {
+		from, to := nodes[ancestor.ID()], nodes[descendant.ID()]
+		if from == nil || to == nil || layers[ancestor.ID()] >= layers[descendant.ID()] {
+			return fmt.Errorf("can not draw the dependency %s -> %s", ancestor.ID(), descendant.ID())
+		}
+		for layer := layers[ancestor.ID()] + 1; layer < layers[descendant.ID()]; layer++ {
+			dummy := &asciiNode{label: "|"}
+			rows[layer] = append(rows[layer], dummy)
+			from.downstreams = append(from.downstreams, dummy)
+			dummy.upstreams = append(dummy.upstreams, from)
+			from = dummy
+		}
+		from.downstreams = append(from.downstreams, to)
+		to.upstreams = append(to.upstreams, from)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		if i > 0 {
+			barycenters := make(map[*asciiNode]float64, len(row))
+			for _, node := range row {
+				barycenters[node] = asciiBarycenter(node)
+			}
+			sort.SliceStable(row, func(a, b int) bool {
+				return barycenters[row[a]] < barycenters[row[b]]
+			})
+		}
+		for j, node := range row {
+			if i > 0 {
+				node.start = int(math.Round(asciiBarycenter(node))) - node.width()/2
+			}
+			if j > 0 {
+				if next := row[j-1].start + row[j-1].width() + 2; node.start < next {
+					node.start = next
+				}
+			}
+		}
+	}
+	// the node under the upstream nodes may be placed to the left of the first column.
+	minStart := 0
+	for _, row := range rows {
+		if len(row) > 0 && row[0].start < minStart {
+			minStart = row[0].start
+		}
+	}
+	for _, row := range rows {
+		for _, node := range row {
+			node.start -= minStart
+		}
+	}
+	return rows, nil
+}
+
+func asciiBarycenter(node *asciiNode) float64 {
+	if len(node.upstreams) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, upstream := range node.upstreams {
+		sum += upstream.center()
+	}
+	return float64(sum) / float64(len(node.upstreams))
+}
+
+// asciiEdges draws the edges from the row to the next row.
+// Each node with the downstream nodes in the other columns has its own horizontal track, so that the edges of the different nodes do not merge.
+func asciiEdges(row []*asciiNode) string {
+	var sources, straights []*asciiNode
+	for _, node := range row {
+		switch {
+		case len(node.downstreams) == 0:
+		case len(node.downstreams) == 1 && node.downstreams[0].center() == node.center():
+			straights = append(straights, node)
+		default:
+			sources = append(sources, node)
+		}
+	}
+	var builder strings.Builder
+	canvas := &asciiCanvas{}
+	for _, node := range row {
+		if len(node.downstreams) > 0 {
+			canvas.set(node.center(), '|')
+		}
+	}
+	builder.WriteString(canvas.String())
+	for j, source := range sources {
+		canvas := &asciiCanvas{}
+		for _, node := range straights {
+			canvas.set(node.center(), '|')
+		}
+		for k, other := range sources {
+			switch {
+			case k > j:
+				canvas.set(other.center(), '|')
+			case k < j:
+				for _, downstream := range other.downstreams {
+					canvas.set(downstream.center(), '|')
+				}
+			}
+		}
+		cols := []int{source.center()}
+		for _, downstream := range source.downstreams {
+			cols = append(cols, downstream.center())
+		}
+		sort.Ints(cols)
+		for col := cols[0]; col <= cols[len(cols)-1]; col++ {
+			if canvas.get(col) == ' ' {
+				canvas.set(col, '-')
+			}
+		}
+		for _, col := range cols {
+			canvas.set(col, '+')
+		}
+		builder.WriteString(canvas.String())
+	}
+	canvas = &asciiCanvas{}
+	for _, node := range row {
+		for _, downstream := range node.downstreams {
+			if downstream.task == nil {
+				canvas.set(downstream.center(), '|')
+			} else {
+				canvas.set(downstream.center(), 'v')
+			}
+		}
+	}
+	builder.WriteString(canvas.String())
+	return builder.String()
+}
+
+// asciiCanvas is the line of the drawing.
+type asciiCanvas struct {
+	line []rune
+}
+
+func (c *asciiCanvas) get(col int) rune {
+	if col >= len(c.line) {
+		return ' '
+	}
+	return c.line[col]
+}
+
+func (c *asciiCanvas) set(col int, r rune) {
+	for len(c.line) <= col {
+		c.line = append(c.line, ' ')
+	}
+	c.line[col] = r
+}
+
+func (c *asciiCanvas) write(col int, s string) {
+	for i, r := range []rune(s) {
+		c.set(col+i, r)
+	}
+}
+
+func (c *asciiCanvas) String() string {
+	return strings.TrimRight(string(c.line), " ") + "\n"
+}
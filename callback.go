@@ -0,0 +1,147 @@
+package lambdag
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/samber/lo"
+)
+
+// TaskCallback is invoked on the task lifecycle event. err is nil on success.
+type TaskCallback func(ctx context.Context, dagRunCtx *DAGRunContext, taskID string, err error)
+
+// DAGRunCallback is invoked on the DAG run lifecycle event. err is nil on success and circuit break.
+type DAGRunCallback func(ctx context.Context, dagRunCtx *DAGRunContext, err error)
+
+// WithOnTaskSuccess adds the callback invoked when the task succeeded.
+func WithOnTaskSuccess(fn TaskCallback) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		opts.onSuccess = append(opts.onSuccess, fn)
+		return nil
+	}
+}
+
+// WithOnTaskFailure adds the callback invoked when the task failed with not retryable error.
+func WithOnTaskFailure(fn TaskCallback) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		opts.onFailure = append(opts.onFailure, fn)
+		return nil
+	}
+}
+
+// WithOnTaskRetry adds the callback invoked when the task failed with TaskRetryableError.
+func WithOnTaskRetry(fn TaskCallback) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		opts.onRetry = append(opts.onRetry, fn)
+		return nil
+	}
+}
+
+// WithOnDAGRunSuccess adds the callback invoked when all tasks in the DAG run succeeded.
+func WithOnDAGRunSuccess(fn DAGRunCallback) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		opts.onDAGRunSuccess = append(opts.onDAGRunSuccess, fn)
+		return nil
+	}
+}
+
+// WithOnDAGRunFailure adds the callback invoked when the DAG run failed with not retryable error.
+func WithOnDAGRunFailure(fn DAGRunCallback) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		opts.onDAGRunFailure = append(opts.onDAGRunFailure, fn)
+		return nil
+	}
+}
+
+// WithOnDAGRunCircuitBreak adds the callback invoked when the DAG run is stopped by the circuit breaker.
+func WithOnDAGRunCircuitBreak(fn DAGRunCallback) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		opts.onDAGRunCircuitBreak = append(opts.onDAGRunCircuitBreak, fn)
+		return nil
+	}
+}
+
+// Lifecycle events are recorded in DAGRunContext, and the callbacks are queued to be invoked after the record is kept.
+// With DAGRunStateStore, LambdaHandler invokes the callbacks after the DAG run context is saved,
+// so each event is notified at most once even if the invocation is retried or conflicts with another invocation.
+// Without DAGRunStateStore, a failed invocation loses the record with the DAG run context, so the retry notifies the failure again.
+const (
+	dagRunEventSuccess      = "success"
+	dagRunEventFailure      = "failure"
+	dagRunEventCircuitBreak = "circuit_break"
+)
+
+func (dag *DAG) queueDAGRunCallbacks(dagRunCtx *DAGRunContext, event string, callbacks []DAGRunCallback, err error) {
+	if len(callbacks) == 0 {
+		return
+	}
+	if lo.Contains(dagRunCtx.DAGRunCallbacksFired, event) {
+		return
+	}
+	dagRunCtx.DAGRunCallbacksFired = append(dagRunCtx.DAGRunCallbacksFired, event)
+	for _, callback := range callbacks {
+		callback := callback
+		dagRunCtx.pendingCallbacks = append(dagRunCtx.pendingCallbacks, func(ctx context.Context) {
+			callback(ctx, dagRunCtx, err)
+		})
+	}
+}
+
+func (dag *DAG) queueTaskCallbacks(dagRunCtx *DAGRunContext, task *Task, taskErr *TaskError) {
+	var event string
+	var callbacks []TaskCallback
+	var err error
+	switch {
+	case taskErr == nil:
+		event, callbacks = "success", task.opts.onSuccess
+	case taskErr.IsRetryable():
+		event, callbacks, err = "retry", task.opts.onRetry, taskErr.Err
+	default:
+		event, callbacks, err = "failure", task.opts.onFailure, taskErr.Err
+	}
+	if len(callbacks) == 0 {
+		return
+	}
+	event = fmt.Sprintf("%s#%d", event, dagRunCtx.TaskAttempts[task.ID()])
+	if lo.Contains(dagRunCtx.TaskCallbacksFired[task.ID()], event) {
+		return
+	}
+	if dagRunCtx.TaskCallbacksFired == nil {
+		dagRunCtx.TaskCallbacksFired = make(map[string][]string)
+	}
+	dagRunCtx.TaskCallbacksFired[task.ID()] = append(dagRunCtx.TaskCallbacksFired[task.ID()], event)
+	taskID := task.ID()
+	for _, callback := range callbacks {
+		callback := callback
+		dagRunCtx.pendingCallbacks = append(dagRunCtx.pendingCallbacks, func(ctx context.Context) {
+			callback(ctx, dagRunCtx, taskID, err)
+		})
+	}
+}
+
+// invokeCallbacks invokes the queued callbacks, a panic in the callback is recovered and logged.
+func (dag *DAG) invokeCallbacks(ctx context.Context, dagRunCtx *DAGRunContext) {
+	pending := dagRunCtx.pendingCallbacks
+	dagRunCtx.pendingCallbacks = nil
+	for _, callback := range pending {
+		dag.invokeCallback(ctx, dagRunCtx, callback)
+	}
+}
+
+// discardCallbacks drops the queued callbacks, when the record of the events could not be kept.
+func (dag *DAG) discardCallbacks(dagRunCtx *DAGRunContext) {
+	dagRunCtx.pendingCallbacks = nil
+}
+
+func (dag *DAG) invokeCallback(ctx context.Context, dagRunCtx *DAGRunContext, callback func(ctx context.Context)) {
+	defer func() {
+		if r := recover(); r != nil {
+			if l, err := dag.NewSlogger(ctx, dagRunCtx); err == nil {
+				l.Error("callback panic", slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
+			}
+		}
+	}()
+	callback(ctx)
+}
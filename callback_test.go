@@ -0,0 +1,197 @@
+package lambdag_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+type callbackRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *callbackRecorder) task(event string) lambdag.TaskCallback {
+	return func(ctx context.Context, dagRunCtx *lambdag.DAGRunContext, taskID string, err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.events = append(r.events, fmt.Sprintf("%s %s#%d err=%v", event, taskID, dagRunCtx.TaskAttempts[taskID], err))
+	}
+}
+
+func (r *callbackRecorder) dagRun(event string) lambdag.DAGRunCallback {
+	return func(ctx context.Context, dagRunCtx *lambdag.DAGRunContext, err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.events = append(r.events, fmt.Sprintf("%s err=%v", event, err))
+	}
+}
+
+func (r *callbackRecorder) taskOptions() []func(opts *lambdag.TaskOptions) error {
+	return []func(opts *lambdag.TaskOptions) error{
+		lambdag.WithOnTaskSuccess(r.task("success")),
+		lambdag.WithOnTaskRetry(r.task("retry")),
+		lambdag.WithOnTaskFailure(r.task("failure")),
+	}
+}
+
+func (r *callbackRecorder) dagOptions() []func(opts *lambdag.DAGOptions) error {
+	return []func(opts *lambdag.DAGOptions) error{
+		lambdag.WithOnDAGRunSuccess(r.dagRun("dag success")),
+		lambdag.WithOnDAGRunFailure(r.dagRun("dag failure")),
+		lambdag.WithOnDAGRunCircuitBreak(r.dagRun("dag circuit break")),
+	}
+}
+
+func TestLifecycleCallbacksSuccess(t *testing.T) {
+	recorder := &callbackRecorder{}
+	dag, err := lambdag.NewDAG("CallbackDAG", append(recorder.dagOptions(), lambdag.WithNumOfTasksInSingleInvoke(2))...)
+	require.NoError(t, err)
+	task1, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		if tr.Attempt < 2 {
+			return nil, lambdag.WrapTaskRetryable(errors.New("try again"))
+		}
+		return "task1 success", nil
+	}), recorder.taskOptions()...)
+	require.NoError(t, err)
+	task2, err := dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task2 success", nil
+	}), recorder.taskOptions()...)
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2))
+
+	handler := lambdag.NewLambdaHandler(dag)
+	dagRunCtx := invokeUntilEnd(t, handler, []byte(`{}`))
+	require.False(t, dagRunCtx.Continue)
+	payload, err := json.Marshal(dagRunCtx)
+	require.NoError(t, err)
+	// invoking the finished DAG run again does not notify again.
+	invokeUntilEnd(t, handler, payload)
+	require.EqualValues(t, []string{
+		"retry task1#1 err=task retryable:try again",
+		"success task1#2 err=<nil>",
+		"success task2#1 err=<nil>",
+		"dag success err=<nil>",
+	}, recorder.events)
+}
+
+func TestLifecycleCallbacksFailure(t *testing.T) {
+	recorder := &callbackRecorder{}
+	store, err := lambdag.NewFileDAGRunStateStore(t.TempDir())
+	require.NoError(t, err)
+	dag, err := lambdag.NewDAG("CallbackDAG", append(recorder.dagOptions(), lambdag.WithDAGRunStateStore(store))...)
+	require.NoError(t, err)
+	var dagRunID string
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		dagRunID = tr.DAGRunID
+		return nil, errors.New("task1 error")
+	}), recorder.taskOptions()...)
+	require.NoError(t, err)
+
+	handler := lambdag.NewLambdaHandler(dag)
+	_, err = handler.Invoke(context.Background(), []byte(`{}`))
+	require.Error(t, err)
+	// the failed state is saved, so the retry of the invocation is the next attempt.
+	_, err = handler.Invoke(context.Background(), []byte(`{"DAGRunId":"`+dagRunID+`"}`))
+	require.Error(t, err)
+	require.EqualValues(t, []string{
+		"failure task1#1 err=task1 error",
+		"dag failure err=task `task1` failed: task1 error",
+		"failure task1#2 err=task1 error",
+	}, recorder.events)
+}
+
+func TestLifecycleCallbacksCircuitBreak(t *testing.T) {
+	recorder := &callbackRecorder{}
+	dag, err := lambdag.NewDAG("CallbackDAG", append(recorder.dagOptions(), lambdag.WithCircuitBreaker(2))...)
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task1 success", nil
+	}))
+	require.NoError(t, err)
+	dagRunCtx := &lambdag.DAGRunContext{
+		DAGRunID:        "test-run",
+		LambdaCallCount: 1,
+	}
+	for i := 0; i < 2; i++ {
+		dagRunCtx, err = dag.Execute(context.Background(), dagRunCtx)
+		require.NoError(t, err)
+		require.True(t, dagRunCtx.IsCircuitBreak)
+	}
+	require.EqualValues(t, []string{
+		"dag circuit break err=<nil>",
+	}, recorder.events)
+}
+
+type conflictingStateStore struct {
+	lambdag.DAGRunStateStore
+}
+
+func (s *conflictingStateStore) SaveDAGRunContext(ctx context.Context, dagRunCtx *lambdag.DAGRunContext, expectedVersion int64) (int64, error) {
+	return 0, &lambdag.DAGRunStateConflictError{
+		DAGRunID:        dagRunCtx.DAGRunID,
+		ExpectedVersion: expectedVersion,
+		ActualVersion:   expectedVersion + 1,
+	}
+}
+
+func TestLifecycleCallbacksStateConflict(t *testing.T) {
+	recorder := &callbackRecorder{}
+	store := &conflictingStateStore{DAGRunStateStore: lambdag.NewKeyValueDAGRunStateStore(lambdag.NewInMemoryKeyValueStore(), "")}
+	dag, err := lambdag.NewDAG("CallbackDAG", append(recorder.dagOptions(), lambdag.WithDAGRunStateStore(store))...)
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task1 success", nil
+	}), recorder.taskOptions()...)
+	require.NoError(t, err)
+
+	_, err = lambdag.NewLambdaHandler(dag).Invoke(context.Background(), []byte(`{}`))
+	var ive messages.InvokeResponse_Error
+	require.True(t, errors.As(err, &ive))
+	require.EqualValues(t, "LambDAG.StateConflict", ive.Type)
+	require.Empty(t, recorder.events, "callbacks are not invoked when the record of the events is not saved")
+}
+
+func TestLifecycleCallbacksPayloadTooLarge(t *testing.T) {
+	recorder := &callbackRecorder{}
+	dag, err := lambdag.NewDAG("CallbackDAG", append(recorder.dagOptions(), lambdag.WithPayloadSizeLimit(100))...)
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task1 success", nil
+	}), recorder.taskOptions()...)
+	require.NoError(t, err)
+
+	_, err = lambdag.NewLambdaHandler(dag).Invoke(context.Background(), []byte(`{}`))
+	var ive messages.InvokeResponse_Error
+	require.True(t, errors.As(err, &ive))
+	require.EqualValues(t, "LambDAG.PayloadTooLarge", ive.Type)
+	require.Empty(t, recorder.events, "callbacks are not invoked when the response is rejected")
+}
+
+func TestLifecycleCallbacksPanic(t *testing.T) {
+	recorder := &callbackRecorder{}
+	dag, err := lambdag.NewDAG("CallbackDAG", append(recorder.dagOptions(), lambdag.WithOnDAGRunSuccess(func(ctx context.Context, dagRunCtx *lambdag.DAGRunContext, err error) {
+		panic("callback panic")
+	}))...)
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task1 success", nil
+	}), lambdag.WithOnTaskSuccess(func(ctx context.Context, dagRunCtx *lambdag.DAGRunContext, taskID string, err error) {
+		panic("callback panic")
+	}), lambdag.WithOnTaskSuccess(recorder.task("success")))
+	require.NoError(t, err)
+
+	dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+	require.False(t, dagRunCtx.Continue)
+	require.EqualValues(t, []string{
+		"success task1#1 err=<nil>",
+		"dag success err=<nil>",
+	}, recorder.events)
+}
@@ -0,0 +1,74 @@
+package lambdag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ResponseCodec encodes the value returned by TaskHandler into the JSON value stored in TaskResponses,
+// and decodes it for the downstream tasks.
+type ResponseCodec interface {
+	Encode(v interface{}) (json.RawMessage, error)
+	Decode(data json.RawMessage, v interface{}) error
+}
+
+func WithTaskResponseCodec(codec ResponseCodec) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		if codec == nil {
+			return errors.New("response codec is nil")
+		}
+		opts.responseCodec = codec
+		return nil
+	}
+}
+
+// WithTaskResponseSizeLimit fails the task if the response encoded by the ResponseCodec is larger than limitBytes.
+// The limit applies to the encoded response before the compression and the encryption of the DAG.
+func WithTaskResponseSizeLimit(limitBytes int) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		if limitBytes <= 0 {
+			return errors.New("response size limit must be positive")
+		}
+		opts.responseSizeLimit = limitBytes
+		return nil
+	}
+}
+
+// TaskResponseTooLargeError is returned when the response exceeds the limit of WithTaskResponseSizeLimit.
+type TaskResponseTooLargeError struct {
+	TaskID     string
+	Size       int
+	LimitBytes int
+}
+
+func (err *TaskResponseTooLargeError) Error() string {
+	return fmt.Sprintf("task `%s` response size %d bytes exceeds the limit %d bytes", err.TaskID, err.Size, err.LimitBytes)
+}
+
+// JSONCodec is the default ResponseCodec.
+// json.RawMessage is passed through as it is, and other values are encoded by json.Marshal,
+// so []byte is encoded as a base64 string.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(v interface{}) (json.RawMessage, error) {
+	if raw, ok := v.(json.RawMessage); ok {
+		if !json.Valid(raw) {
+			return nil, &json.MarshalerError{
+				Type: reflect.TypeOf(raw),
+				Err:  errors.New("invalid JSON"),
+			}
+		}
+		return raw, nil
+	}
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Decode(data json.RawMessage, v interface{}) error {
+	if raw, ok := v.(*json.RawMessage); ok {
+		*raw = append((*raw)[:0], data...)
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,32 @@
+// Package cbor provides lambdag.ResponseCodec which encodes task responses with CBOR.
+package cbor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Codec encodes the response with CBOR, and stores it as a base64 JSON string.
+type Codec struct{}
+
+func (Codec) Encode(v interface{}) (json.RawMessage, error) {
+	bs, err := cbor.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(bs))
+}
+
+func (Codec) Decode(data json.RawMessage, v interface{}) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	bs, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return err
+	}
+	return cbor.Unmarshal(bs, v)
+}
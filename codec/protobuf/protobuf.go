@@ -0,0 +1,49 @@
+// Package protobuf provides lambdag.ResponseCodec which encodes task responses implementing proto.Message.
+package protobuf
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes the response that implements proto.Message, and stores it as a base64 JSON string.
+type Codec struct{}
+
+func (Codec) Encode(v interface{}) (json.RawMessage, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not proto.Message", v)
+	}
+	bs, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(bs))
+}
+
+// Decode accepts proto.Message, or the pointer to the proto.Message pointer which is allocated if nil.
+func (Codec) Decode(data json.RawMessage, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if rv := reflect.ValueOf(v); !ok && rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		msg, ok = rv.Elem().Interface().(proto.Message)
+	}
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not proto.Message", v)
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	bs, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(bs, msg)
+}
@@ -0,0 +1,66 @@
+package lambdag_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mashiike/lambdag"
+	"github.com/mashiike/lambdag/codec/cbor"
+	"github.com/mashiike/lambdag/codec/protobuf"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecTestOutput struct {
+	Name  string
+	Count int
+}
+
+func TestResponseCodec(t *testing.T) {
+	dag, err := lambdag.NewDAG("CodecDAG", lambdag.WithNumOfTasksInSingleInvoke(4))
+	require.NoError(t, err)
+	rawTask, err := dag.NewTask("raw", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return json.RawMessage(`"raw success"`), nil
+	}))
+	require.NoError(t, err)
+	cborTask, err := dag.NewTask("cbor", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return &codecTestOutput{Name: "cbor", Count: 2}, nil
+	}), lambdag.WithTaskResponseCodec(cbor.Codec{}))
+	require.NoError(t, err)
+	protoTask, err := dag.NewTask("proto", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return wrapperspb.String("proto success"), nil
+	}), lambdag.WithTaskResponseCodec(protobuf.Codec{}))
+	require.NoError(t, err)
+
+	var rawResp string
+	var cborResp codecTestOutput
+	var protoResp *wrapperspb.StringValue
+	downstream, err := dag.NewTask("downstream", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		var err error
+		if rawResp, err = lambdag.GetUpstreamResponse[string](tr, "raw"); err != nil {
+			return nil, err
+		}
+		if cborResp, err = lambdag.GetUpstreamResponse[codecTestOutput](tr, "cbor"); err != nil {
+			return nil, err
+		}
+		if protoResp, err = lambdag.GetUpstreamResponse[*wrapperspb.StringValue](tr, "proto"); err != nil {
+			return nil, err
+		}
+		return "ok", nil
+	}))
+	require.NoError(t, err)
+	require.NoError(t, downstream.SetUpstream(rawTask, cborTask, protoTask))
+
+	dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+	require.EqualValues(t, `"raw success"`, string(dagRunCtx.TaskResponses["raw"]), "json.RawMessage is not double encoded")
+	require.EqualValues(t, "raw success", rawResp)
+	require.EqualValues(t, codecTestOutput{Name: "cbor", Count: 2}, cborResp)
+	require.EqualValues(t, "proto success", protoResp.GetValue())
+}
+
+func TestJSONCodecInvalidRawMessage(t *testing.T) {
+	_, err := lambdag.JSONCodec{}.Encode(json.RawMessage(`{invalid`))
+	var jme *json.MarshalerError
+	require.ErrorAs(t, err, &jme)
+}
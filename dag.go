@@ -2,15 +2,19 @@ package lambdag
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"log"
+	"log/slog"
 	"sort"
 	"sync"
 
 	"github.com/Songmu/flextime"
 	libdag "github.com/heimdalr/dag"
 	"github.com/samber/lo"
-	"golang.org/x/sync/errgroup"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DAG struct {
@@ -21,8 +25,27 @@ type DAG struct {
 
 type DAGOptions struct {
 	newLoggerFunc            func(context.Context, *DAGRunContext) (*log.Logger, error)
+	newSloggerFunc           func(context.Context, *DAGRunContext) (*slog.Logger, error)
 	numOfTasksInSingleInvoke int
 	circuitBreaker           int
+	responseStore            ResponseStore
+	responseStoreThreshold   int
+	dagRunStateStore         DAGRunStateStore
+	taskResponseCompression  bool
+	keyProvider              KeyProvider
+	secretProvider           SecretProvider
+	dagChangePolicy          DAGChangePolicy
+	taskIDMigration          func(oldTaskID string) (newTaskID string, ok bool)
+	payloadSizeLimit         int
+	payloadSizeWarning       int
+	middlewares              []TaskMiddleware
+	onDAGRunSuccess          []DAGRunCallback
+	onDAGRunFailure          []DAGRunCallback
+	onDAGRunCircuitBreak     []DAGRunCallback
+	tracerProvider           trace.TracerProvider
+	ownedTracerProvider      *sdktrace.TracerProvider
+	metricsSink              MetricsSink
+	taskInstanceHistoryLimit int
 }
 
 func WithDAGLogger(fn func(context.Context, *DAGRunContext) (*log.Logger, error)) func(opts *DAGOptions) error {
@@ -80,11 +103,17 @@ func (dag *DAG) NewTask(taskID string, handler TaskHandler, optFns ...func(opts
 	return task, err
 }
 
+// NewLogger returns *log.Logger of the DAG run.
+// The *log.Logger of WithDAGLogger is used as it is, otherwise it writes to the structured logger of NewSlogger.
 func (dag *DAG) NewLogger(ctx context.Context, dagRunCtx *DAGRunContext) (*log.Logger, error) {
-	if dag.opts.newLoggerFunc == nil {
-		return log.Default(), nil
+	l, ll, err := dag.newLoggers(ctx, dagRunCtx)
+	if err != nil {
+		return nil, err
 	}
-	return dag.opts.newLoggerFunc(ctx, dagRunCtx)
+	if ll != nil {
+		return ll, nil
+	}
+	return slog.NewLogLogger(l.With(dag.slogAttrs(dagRunCtx)...).Handler(), slog.LevelInfo), nil
 }
 
 func (dag *DAG) NumOfTasksInSingleInvoke() int {
@@ -103,6 +132,10 @@ func (dag *DAG) CircuitBreaker() int {
 	return dag.opts.circuitBreaker
 }
 
+func (dag *DAG) DAGRunStateStore() DAGRunStateStore {
+	return dag.opts.dagRunStateStore
+}
+
 func (dag *DAG) AddDependency(ancestor *Task, descendant *Task) error {
 	if err := dag.dependencies.AddEdge(ancestor.ID(), descendant.ID()); err != nil {
 		var ede libdag.EdgeDuplicateError
@@ -228,60 +261,147 @@ func (dag *DAG) WarkAllDependencies(fn func(ancestor *Task, descendant *Task) er
 	return nil
 }
 
+// Execute executes the executable tasks of the DAG run, and invokes the lifecycle callbacks before returning.
 func (dag *DAG) Execute(ctx context.Context, dagRunCtx *DAGRunContext) (*DAGRunContext, error) {
-	l, err := dag.NewLogger(ctx, dagRunCtx)
+	updatedDAGRunCtx, err := dag.executeWithSpan(ctx, dagRunCtx)
+	dag.invokeCallbacks(ctx, dagRunCtx)
+	return updatedDAGRunCtx, err
+}
+
+// executeWithSpan is Execute without invoking the lifecycle callbacks, the callbacks are queued in dagRunCtx.
+func (dag *DAG) executeWithSpan(ctx context.Context, dagRunCtx *DAGRunContext) (*DAGRunContext, error) {
+	ctx, span := dag.tracer().Start(ctx, "lambdag.DAG.Execute", trace.WithAttributes(
+		attribute.String("lambdag.dag_id", dag.ID()),
+		attribute.String("lambdag.dag_run_id", dagRunCtx.DAGRunID),
+	))
+	updatedDAGRunCtx, err := dag.execute(ctx, dagRunCtx)
+	endSpan(span, err)
+	return updatedDAGRunCtx, err
+}
+
+func (dag *DAG) execute(ctx context.Context, dagRunCtx *DAGRunContext) (*DAGRunContext, error) {
+	l, _, err := dag.newLoggers(ctx, dagRunCtx)
 	if err != nil {
 		return dagRunCtx, err
 	}
+	l = l.With(slog.String("dag_id", dag.ID()), slog.String("dag_run_id", dagRunCtx.DAGRunID))
 	if dagRunCtx.LambdaCallCount == 0 {
-		l.Printf("[info] start new DAG: DAGRunId %s", dagRunCtx.DAGRunID)
+		l.Info("start new DAG")
+	}
+	if err := dag.validateDAGRunContext(ctx, l, dagRunCtx); err != nil {
+		dag.putDAGRunMetrics(ctx, dagRunCtx, dagRunEventFailure)
+		dag.queueDAGRunCallbacks(dagRunCtx, dagRunEventFailure, dag.opts.onDAGRunFailure, err)
+		return dagRunCtx, err
 	}
 	dagRunCtx.LambdaCallCount++
+	l = l.With(slog.Int("lambda_call_count", dagRunCtx.LambdaCallCount))
 	if dagRunCtx.LambdaCallCount >= dag.CircuitBreaker() {
-		l.Printf("[info] DAG run CircuitBreak: DAGRunId %s    Lambda call Count %d", dagRunCtx.DAGRunID, dagRunCtx.LambdaCallCount)
+		l.Info("DAG run CircuitBreak")
+		if !dagRunCtx.IsCircuitBreak {
+			dag.putDAGRunMetrics(ctx, dagRunCtx, dagRunEventCircuitBreak)
+		}
 		dagRunCtx.Continue = false
 		dagRunCtx.IsCircuitBreak = true
+		dag.queueDAGRunCallbacks(dagRunCtx, dagRunEventCircuitBreak, dag.opts.onDAGRunCircuitBreak, nil)
 		return dagRunCtx, nil
 	}
 	finishedTasks := lo.Keys(dagRunCtx.TaskResponses)
 	executableTasks := dag.GetExecutableTasks(finishedTasks)
+	// the DAG run already ended if the previous invocation did not continue, invoking it again does not emit the metrics.
+	running := dagRunCtx.Continue || dagRunCtx.LambdaCallCount == 1
 	dagRunCtx.Continue = true
 	if len(executableTasks) == 0 {
 		now := flextime.Now()
-		l.Printf("[info] end DAG: DAGRunId %s    DAG Run duration %s", dagRunCtx.DAGRunID, now.Sub(dagRunCtx.DAGRunStartAt))
+		l.Info("end DAG", slog.Duration("duration", now.Sub(dagRunCtx.DAGRunStartAt)))
 		dagRunCtx.Continue = false
+		if running {
+			dag.putDAGRunMetrics(ctx, dagRunCtx, dagRunEventSuccess)
+		}
+		dag.queueDAGRunCallbacks(dagRunCtx, dagRunEventSuccess, dag.opts.onDAGRunSuccess, nil)
 		return dagRunCtx, nil
 	}
-	eg, egCtx := errgroup.WithContext(ctx)
+	// task responses are merged into dagRunCtx after all tasks finished,
+	// because running tasks read dagRunCtx.TaskResponses.
+	var wg sync.WaitGroup
 	var mu sync.Mutex
-	for i := 0; i < dag.NumOfTasksInSingleInvoke(); i++ {
-		if i >= len(executableTasks) {
-			break
-		}
-		task := executableTasks[i]
-		eg.Go(func() error {
+	taskErrs := make([]*TaskError, 0)
+	taskResps := make(map[string]json.RawMessage)
+	taskInstances := make([]TaskInstance, 0, len(executableTasks))
+	if len(executableTasks) > dag.NumOfTasksInSingleInvoke() {
+		executableTasks = executableTasks[:dag.NumOfTasksInSingleInvoke()]
+	}
+	// attempts are counted before starting tasks, because running tasks read dagRunCtx.TaskAttempts.
+	if dagRunCtx.TaskAttempts == nil {
+		dagRunCtx.TaskAttempts = make(map[string]int)
+	}
+	for _, task := range executableTasks {
+		dagRunCtx.TaskAttempts[task.ID()]++
+	}
+	for _, task := range executableTasks {
+		task := task
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 			taskID := task.ID()
-			l.Printf("[info] start task: DAGRunId %s    TaskId %s", dagRunCtx.DAGRunID, taskID)
-			resp, err := task.Execute(egCtx, dagRunCtx)
-			l.Printf("[info] end task: DAGRunId %s    TaskId %s  Success %v", dagRunCtx.DAGRunID, taskID, err == nil)
-			if err != nil {
-				return err
-			}
+			tl := l.With(slog.String("task_id", taskID), slog.Int("attempt", dagRunCtx.TaskAttempts[taskID]))
+			tl.Info("start task")
+			startAt := flextime.Now()
+			resp, err := task.Execute(ctx, dagRunCtx)
+			endAt := flextime.Now()
+			tl.Info("end task", slog.Bool("success", err == nil))
 			mu.Lock()
 			defer mu.Unlock()
-			dagRunCtx.TaskResponses[taskID] = resp
-			finishedTasks = append(finishedTasks, taskID)
-			return nil
+			taskInstances = append(taskInstances, newTaskInstance(ctx, dagRunCtx, taskID, startAt, endAt, err))
+			if err != nil {
+				taskErrs = append(taskErrs, &TaskError{
+					TaskID: taskID,
+					Err:    err,
+				})
+				return
+			}
+			taskResps[taskID] = resp
+		}()
+	}
+	wg.Wait()
+	if dagRunCtx.TaskResponses == nil {
+		dagRunCtx.TaskResponses = make(map[string]json.RawMessage)
+	}
+	for taskID, resp := range taskResps {
+		dagRunCtx.TaskResponses[taskID] = resp
+		finishedTasks = append(finishedTasks, taskID)
+	}
+	sort.SliceStable(taskInstances, func(i, j int) bool {
+		if !taskInstances[i].StartAt.Equal(taskInstances[j].StartAt) {
+			return taskInstances[i].StartAt.Before(taskInstances[j].StartAt)
+		}
+		return taskInstances[i].TaskID < taskInstances[j].TaskID
+	})
+	dag.appendTaskInstances(dagRunCtx, taskInstances...)
+	sort.SliceStable(taskErrs, func(i, j int) bool {
+		return taskErrs[i].TaskID < taskErrs[j].TaskID
+	})
+	// callbacks are invoked after all tasks finished, executableTasks is sorted by task ID.
+	for _, task := range executableTasks {
+		taskErr, _ := lo.Find(taskErrs, func(taskErr *TaskError) bool {
+			return taskErr.TaskID == task.ID()
 		})
+		dag.queueTaskCallbacks(dagRunCtx, task, taskErr)
 	}
-	if err := eg.Wait(); err != nil {
-		return dagRunCtx, err
+	if len(taskErrs) > 0 {
+		mte := &MultiTaskError{Errors: taskErrs}
+		if !mte.IsRetryable() {
+			dag.putDAGRunMetrics(ctx, dagRunCtx, dagRunEventFailure)
+			dag.queueDAGRunCallbacks(dagRunCtx, dagRunEventFailure, dag.opts.onDAGRunFailure, mte)
+		}
+		return dagRunCtx, mte
 	}
 	executableTasks = dag.GetExecutableTasks(finishedTasks)
 	if len(executableTasks) == 0 {
 		now := flextime.Now()
-		l.Printf("[info] end DAG: DAGRunId %s    DAG Run duration %s", dagRunCtx.DAGRunID, now.Sub(dagRunCtx.DAGRunStartAt))
+		l.Info("end DAG", slog.Duration("duration", now.Sub(dagRunCtx.DAGRunStartAt)))
 		dagRunCtx.Continue = false
+		dag.putDAGRunMetrics(ctx, dagRunCtx, dagRunEventSuccess)
+		dag.queueDAGRunCallbacks(dagRunCtx, dagRunEventSuccess, dag.opts.onDAGRunSuccess, nil)
 	}
 	return dagRunCtx, nil
 }
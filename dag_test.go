@@ -2,7 +2,10 @@ package lambdag_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"sort"
+	"sync"
 	"testing"
 
 	"github.com/mashiike/lambdag"
@@ -87,3 +90,121 @@ func requireTasksMatch(t *testing.T, listA []*lambdag.Task, listB []*lambdag.Tas
 	})
 	require.EqualValues(t, listA, listB, msgAndArgs...)
 }
+
+func TestDAGExecuteMultiTaskError(t *testing.T) {
+	dag, err := lambdag.NewDAG("test", lambdag.WithNumOfTasksInSingleInvoke(3))
+	require.NoError(t, err)
+	errTask1 := errors.New("task1 error")
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return nil, errTask1
+	}))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return nil, lambdag.WrapTaskRetryable(errors.New("task2 error"))
+	}))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task3", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task3 success", nil
+	}))
+	require.NoError(t, err)
+
+	dagRunCtx, err := dag.Execute(context.Background(), &lambdag.DAGRunContext{
+		DAGRunID:      "test-run",
+		TaskResponses: map[string]json.RawMessage{},
+	})
+	require.Error(t, err)
+	var mte *lambdag.MultiTaskError
+	require.True(t, errors.As(err, &mte))
+	require.EqualValues(t, []string{"task1", "task2"}, mte.TaskIDs())
+	require.False(t, mte.IsRetryable())
+	require.False(t, mte.Errors[0].IsRetryable())
+	require.True(t, mte.Errors[1].IsRetryable())
+	require.ErrorIs(t, err, errTask1)
+	var tre *lambdag.TaskRetryableError
+	require.True(t, errors.As(err, &tre))
+	require.EqualError(t, err, "2 tasks failed: task `task1` failed: task1 error; task `task2` failed: task retryable:task2 error")
+	require.EqualValues(t, map[string]json.RawMessage{
+		"task3": json.RawMessage(`"task3 success"`),
+	}, dagRunCtx.TaskResponses)
+}
+
+func TestDAGExecuteTaskPanic(t *testing.T) {
+	dag, err := lambdag.NewDAG("test", lambdag.WithNumOfTasksInSingleInvoke(2))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		panic("something wrong")
+	}))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task2 success", nil
+	}))
+	require.NoError(t, err)
+
+	dagRunCtx, err := dag.Execute(context.Background(), &lambdag.DAGRunContext{
+		DAGRunID:      "test-run",
+		TaskResponses: map[string]json.RawMessage{},
+	})
+	var tpe *lambdag.TaskPanicError
+	require.True(t, errors.As(err, &tpe))
+	require.EqualValues(t, "task1", tpe.TaskID)
+	require.EqualValues(t, "something wrong", tpe.Value)
+	require.NotEmpty(t, tpe.Stack)
+	require.EqualValues(t, map[string]json.RawMessage{
+		"task2": json.RawMessage(`"task2 success"`),
+	}, dagRunCtx.TaskResponses)
+}
+
+func TestDAGExecuteTaskResponsesSnapshot(t *testing.T) {
+	dag, err := lambdag.NewDAG("test", lambdag.WithNumOfTasksInSingleInvoke(3))
+	require.NoError(t, err)
+	var mu sync.Mutex
+	visible := make(map[string][]string)
+	newHandler := func(taskID string) lambdag.TaskHandler {
+		return lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+			keys := make([]string, 0, len(tr.TaskResponses))
+			for key, resp := range tr.TaskResponses {
+				keys = append(keys, key)
+				resp[0] = 'x'
+			}
+			tr.TaskResponses["injected"] = json.RawMessage(`"injected"`)
+			sort.Strings(keys)
+			mu.Lock()
+			defer mu.Unlock()
+			visible[taskID] = keys
+			return taskID + " success", nil
+		})
+	}
+	// task1 ─> task2 ─> task3
+	// task4
+	task1, err := dag.NewTask("task1", newHandler("task1"))
+	require.NoError(t, err)
+	task2, err := dag.NewTask("task2", newHandler("task2"))
+	require.NoError(t, err)
+	task3, err := dag.NewTask("task3", newHandler("task3"))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task4", newHandler("task4"))
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2))
+	require.NoError(t, task2.SetDownstream(task3))
+
+	dagRunCtx := &lambdag.DAGRunContext{
+		DAGRunID:      "test-run",
+		TaskResponses: map[string]json.RawMessage{},
+	}
+	for dagRunCtx.LambdaCallCount == 0 || dagRunCtx.Continue {
+		dagRunCtx, err = dag.Execute(context.Background(), dagRunCtx)
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, map[string][]string{
+		"task1": {},
+		"task2": {"task1"},
+		"task3": {"task1", "task2"},
+		"task4": {},
+	}, visible)
+	require.EqualValues(t, map[string]json.RawMessage{
+		"task1": json.RawMessage(`"task1 success"`),
+		"task2": json.RawMessage(`"task2 success"`),
+		"task3": json.RawMessage(`"task3 success"`),
+		"task4": json.RawMessage(`"task4 success"`),
+	}, dagRunCtx.TaskResponses)
+}
@@ -0,0 +1,184 @@
+package lambdag
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KeyProvider provides data keys for envelope encryption of task responses.
+// GenerateDataKey returns a 256-bit plaintext data key and the data key encrypted by the master key.
+type KeyProvider interface {
+	GenerateDataKey(ctx context.Context) (plaintextKey []byte, encryptedKey []byte, err error)
+	DecryptDataKey(ctx context.Context, encryptedKey []byte) (plaintextKey []byte, err error)
+}
+
+func WithTaskResponseEncryption(kp KeyProvider) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		if kp == nil {
+			return errors.New("key provider is nil")
+		}
+		opts.keyProvider = kp
+		return nil
+	}
+}
+
+const (
+	dataKeySize         = 32
+	encryptionAES256GCM = "AES-256-GCM"
+)
+
+// StaticKeyProvider encrypts data keys with a static master key, for local use.
+type StaticKeyProvider struct {
+	aead cipher.AEAD
+}
+
+func NewStaticKeyProvider(masterKey []byte) (*StaticKeyProvider, error) {
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticKeyProvider{aead: aead}, nil
+}
+
+func (kp *StaticKeyProvider) GenerateDataKey(_ context.Context) ([]byte, []byte, error) {
+	plaintextKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, plaintextKey); err != nil {
+		return nil, nil, err
+	}
+	nonce, ciphertext, err := seal(kp.aead, plaintextKey, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plaintextKey, append(nonce, ciphertext...), nil
+}
+
+func (kp *StaticKeyProvider) DecryptDataKey(_ context.Context, encryptedKey []byte) ([]byte, error) {
+	nonceSize := kp.aead.NonceSize()
+	if len(encryptedKey) < nonceSize {
+		return nil, errors.New("encrypted data key is too short")
+	}
+	return kp.aead.Open(nil, encryptedKey[:nonceSize], encryptedKey[nonceSize:], nil)
+}
+
+// KMSClient is the subset of the KMS API used by KMSKeyProvider.
+type KMSClient interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMSKeyProvider generates data keys with AWS KMS.
+type KMSKeyProvider struct {
+	client KMSClient
+	keyID  string
+}
+
+func NewKMSKeyProvider(client KMSClient, keyID string) *KMSKeyProvider {
+	return &KMSKeyProvider{
+		client: client,
+		keyID:  keyID,
+	}
+}
+
+func (kp *KMSKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	output, err := kp.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(kp.keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return output.Plaintext, output.CiphertextBlob, nil
+}
+
+func (kp *KMSKeyProvider) DecryptDataKey(ctx context.Context, encryptedKey []byte) ([]byte, error) {
+	output, err := kp.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(kp.keyID),
+		CiphertextBlob: encryptedKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, []byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// taskResponseAdditionalData binds the encrypted task response to the DAG run and the task,
+// so that the encrypted response can not be moved to another DAG run or task.
+func taskResponseAdditionalData(dagRunID string, taskID string) ([]byte, error) {
+	return json.Marshal([]string{dagRunID, taskID})
+}
+
+func encryptTaskResponse(ctx context.Context, kp KeyProvider, dagRunID string, taskID string, data json.RawMessage) (json.RawMessage, error) {
+	additionalData, err := taskResponseAdditionalData(dagRunID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	plaintextKey, encryptedKey, err := kp.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("generate data key: %w", err)
+	}
+	aead, err := newAEAD(plaintextKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := seal(aead, data, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	return wrapTaskResponseEnvelope(&taskResponseEnvelope{
+		Encryption:   encryptionAES256GCM,
+		EncryptedKey: encryptedKey,
+		Nonce:        nonce,
+		Data:         ciphertext,
+	})
+}
+
+func decryptTaskResponse(ctx context.Context, kp KeyProvider, dagRunID string, taskID string, envelope *taskResponseEnvelope) (json.RawMessage, error) {
+	if envelope.Encryption != encryptionAES256GCM {
+		return nil, fmt.Errorf("unsupported encryption `%s`", envelope.Encryption)
+	}
+	if kp == nil {
+		return nil, errors.New("key provider is not configured")
+	}
+	plaintextKey, err := kp.DecryptDataKey(ctx, envelope.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt data key: %w", err)
+	}
+	aead, err := newAEAD(plaintextKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+	additionalData, err := taskResponseAdditionalData(dagRunID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, envelope.Nonce, envelope.Data, additionalData)
+}
@@ -0,0 +1,171 @@
+package lambdag_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeKMSClient struct {
+	kp *lambdag.StaticKeyProvider
+}
+
+func (c *fakeKMSClient) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	plaintext, ciphertext, err := c.kp.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          params.KeyId,
+		Plaintext:      plaintext,
+		CiphertextBlob: ciphertext,
+	}, nil
+}
+
+func (c *fakeKMSClient) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	plaintext, err := c.kp.DecryptDataKey(ctx, params.CiphertextBlob)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.DecryptOutput{
+		KeyId:     params.KeyId,
+		Plaintext: plaintext,
+	}, nil
+}
+
+func TestTaskResponseEncryption(t *testing.T) {
+	staticKey, err := lambdag.NewStaticKeyProvider([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	masterKey, err := lambdag.NewStaticKeyProvider([]byte("fedcba9876543210fedcba9876543210"))
+	require.NoError(t, err)
+	cases := []struct {
+		name string
+		kp   lambdag.KeyProvider
+	}{
+		{name: "static", kp: staticKey},
+		{name: "kms", kp: lambdag.NewKMSKeyProvider(&fakeKMSClient{kp: masterKey}, "alias/lambdag")},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dag, err := lambdag.NewDAG(
+				"EncryptionDAG",
+				lambdag.WithTaskResponseEncryption(c.kp),
+				lambdag.WithTaskResponseCompression(true),
+			)
+			require.NoError(t, err)
+			var received json.RawMessage
+			task1, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+				return map[string]string{"CustomerId": "customer-0001"}, nil
+			}))
+			require.NoError(t, err)
+			task2, err := dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+				received = tr.TaskResponses["task1"]
+				return "ok", nil
+			}))
+			require.NoError(t, err)
+			require.NoError(t, task1.SetDownstream(task2))
+			dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+
+			require.JSONEq(t, `{"CustomerId":"customer-0001"}`, string(received))
+			for taskID, resp := range dagRunCtx.TaskResponses {
+				require.NotContains(t, string(resp), "customer-0001", taskID)
+				require.Contains(t, string(resp), `"Encryption":"AES-256-GCM"`, taskID)
+			}
+		})
+	}
+}
+
+func TestTaskResponseEncryptionTampered(t *testing.T) {
+	kp, err := lambdag.NewStaticKeyProvider([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	handled := make([]string, 0)
+	dag := newChainDAG(t, []string{"task1", "task2", "task3"}, &handled, lambdag.WithTaskResponseEncryption(kp))
+	handler := lambdag.NewLambdaHandler(dag)
+	payload := []byte(`{}`)
+	for i := 0; i < 2; i++ {
+		resp, err := handler.Invoke(context.Background(), payload)
+		require.NoError(t, err)
+		payload = resp
+	}
+	cases := []struct {
+		name     string
+		tamper   func(dagRunCtx *lambdag.DAGRunContext)
+		expected string
+	}{
+		{
+			name: "swapped between tasks",
+			tamper: func(dagRunCtx *lambdag.DAGRunContext) {
+				dagRunCtx.TaskResponses["task1"], dagRunCtx.TaskResponses["task2"] = dagRunCtx.TaskResponses["task2"], dagRunCtx.TaskResponses["task1"]
+			},
+			expected: "response: decrypt response: cipher: message authentication failed",
+		},
+		{
+			name: "moved to another dag run",
+			tamper: func(dagRunCtx *lambdag.DAGRunContext) {
+				dagRunCtx.DAGRunID = "another-run"
+			},
+			expected: "response: decrypt response: cipher: message authentication failed",
+		},
+		{
+			name: "not encrypted",
+			tamper: func(dagRunCtx *lambdag.DAGRunContext) {
+				dagRunCtx.TaskResponses["task1"] = json.RawMessage(`"task1 success"`)
+			},
+			expected: "task `task1` response: response is not encrypted",
+		},
+		{
+			name: "compressed but not encrypted",
+			tamper: func(dagRunCtx *lambdag.DAGRunContext) {
+				dagRunCtx.TaskResponses["task1"] = json.RawMessage(`{"LambDAGEnvelope":{"Version":1,"Compression":"gzip","Data":"H4sIAAAAAAAA/1IqSUzONlQoTs5PSVUCAAAA//8BAAD//w=="}}`)
+			},
+			expected: "task `task1` response: response is not encrypted",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var dagRunCtx lambdag.DAGRunContext
+			require.NoError(t, json.Unmarshal(payload, &dagRunCtx))
+			c.tamper(&dagRunCtx)
+			tampered, err := json.Marshal(dagRunCtx)
+			require.NoError(t, err)
+			handled = handled[:0]
+			_, err = handler.Invoke(context.Background(), tampered)
+			require.ErrorContains(t, err, c.expected)
+			require.Empty(t, handled)
+		})
+	}
+}
+
+func TestTaskResponseEncryptionMigrate(t *testing.T) {
+	kp, err := lambdag.NewStaticKeyProvider([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	handled := make([]string, 0)
+	oldDAG := newChainDAG(t, []string{"task1", "task2", "task3"}, &handled, lambdag.WithTaskResponseEncryption(kp))
+	payload, err := lambdag.NewLambdaHandler(oldDAG).Invoke(context.Background(), []byte(`{}`))
+	require.NoError(t, err)
+
+	var received json.RawMessage
+	recordTask2Request := func(next lambdag.TaskHandler) lambdag.TaskHandler {
+		return lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+			if tr.TaskID == "task2" {
+				received = tr.TaskResponses["renamed"]
+			}
+			return next.Invoke(ctx, tr)
+		})
+	}
+	newDAG := newChainDAG(t, []string{"renamed", "task2", "task3"}, &handled,
+		lambdag.WithTaskResponseEncryption(kp),
+		lambdag.WithTaskMiddleware(recordTask2Request),
+		lambdag.WithDAGChangeMigration(func(oldTaskID string) (string, bool) {
+			return "renamed", oldTaskID == "task1"
+		}),
+	)
+	handled = handled[:0]
+	invokeUntilEnd(t, lambdag.NewLambdaHandler(newDAG), payload)
+	require.EqualValues(t, []string{"task2", "task3"}, handled)
+	require.JSONEq(t, `"task1 success"`, string(received))
+}
@@ -1,6 +1,10 @@
 package lambdag
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 type UnknownError struct {
 	err error
@@ -64,3 +68,126 @@ func (err TaskRetryableError) Unwrap() error {
 func WrapTaskRetryable(err error) error {
 	return &TaskRetryableError{err: err}
 }
+
+// TaskPanicError is returned when a TaskHandler panics while invoking.
+type TaskPanicError struct {
+	TaskID string
+	Value  interface{}
+	Stack  []byte
+}
+
+func (err *TaskPanicError) Error() string {
+	return fmt.Sprintf("task `%s` panic: %v", err.TaskID, err.Value)
+}
+
+func (err *TaskPanicError) Unwrap() error {
+	if e, ok := err.Value.(error); ok {
+		return e
+	}
+	return nil
+}
+
+type TaskError struct {
+	TaskID string
+	Err    error
+}
+
+func (err *TaskError) Error() string {
+	return fmt.Sprintf("task `%s` failed: %s", err.TaskID, err.Err.Error())
+}
+
+func (err *TaskError) Unwrap() error {
+	return err.Err
+}
+
+// IsRetryable reports whether the task failed with TaskRetryableError.
+func (err *TaskError) IsRetryable() bool {
+	var tre *TaskRetryableError
+	return errors.As(err.Err, &tre)
+}
+
+// MultiTaskError holds the errors of all tasks that failed in a single DAG execution.
+// errors.As and errors.Is look into every task error.
+type MultiTaskError struct {
+	Errors []*TaskError
+}
+
+func (err *MultiTaskError) Error() string {
+	if len(err.Errors) == 1 {
+		return err.Errors[0].Error()
+	}
+	msgs := make([]string, 0, len(err.Errors))
+	for _, taskErr := range err.Errors {
+		msgs = append(msgs, taskErr.Error())
+	}
+	return fmt.Sprintf("%d tasks failed: %s", len(err.Errors), strings.Join(msgs, "; "))
+}
+
+// IsRetryable reports whether all task errors are retryable.
+func (err *MultiTaskError) IsRetryable() bool {
+	for _, taskErr := range err.Errors {
+		if !taskErr.IsRetryable() {
+			return false
+		}
+	}
+	return len(err.Errors) > 0
+}
+
+func (err *MultiTaskError) TaskIDs() []string {
+	taskIDs := make([]string, 0, len(err.Errors))
+	for _, taskErr := range err.Errors {
+		taskIDs = append(taskIDs, taskErr.TaskID)
+	}
+	return taskIDs
+}
+
+func (err *MultiTaskError) As(target interface{}) bool {
+	for _, taskErr := range err.Errors {
+		if errors.As(taskErr, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (err *MultiTaskError) Is(target error) bool {
+	for _, taskErr := range err.Errors {
+		if errors.Is(taskErr, target) {
+			return true
+		}
+	}
+	return false
+}
+
+type DAGRunConfigDecodeError struct {
+	err error
+}
+
+func (err *DAGRunConfigDecodeError) Error() string {
+	return fmt.Sprintf("DAG run config decode failed: %s", err.err.Error())
+}
+
+func (err *DAGRunConfigDecodeError) Unwrap() error {
+	return err.err
+}
+
+type UpstreamResponseNotFoundError struct {
+	TaskID string
+}
+
+func (err *UpstreamResponseNotFoundError) Error() string {
+	return fmt.Sprintf("upstream task `%s` response not found", err.TaskID)
+}
+
+type UpstreamResponseDecodeError struct {
+	TaskID string
+	err    error
+}
+
+func (err *UpstreamResponseDecodeError) Error() string {
+	return fmt.Sprintf("upstream task `%s` response decode failed: %s", err.TaskID, err.err.Error())
+}
+
+func (err *UpstreamResponseDecodeError) Unwrap() error {
+	return err.err
+}
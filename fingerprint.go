@@ -0,0 +1,212 @@
+package lambdag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+type DAGChangePolicy int
+
+const (
+	// DAGChangePolicyWarn logs unknown and missing task IDs and continues the DAG run.
+	DAGChangePolicyWarn DAGChangePolicy = iota
+	// DAGChangePolicyFail fails the DAG run with DAGDefinitionChangedError.
+	DAGChangePolicyFail
+	// DAGChangePolicyMigrate renames the task IDs of TaskResponses with the migration function, and then warns.
+	DAGChangePolicyMigrate
+)
+
+func (p DAGChangePolicy) String() string {
+	switch p {
+	case DAGChangePolicyWarn:
+		return "warn"
+	case DAGChangePolicyFail:
+		return "fail"
+	case DAGChangePolicyMigrate:
+		return "migrate"
+	}
+	return fmt.Sprintf("DAGChangePolicy(%d)", int(p))
+}
+
+func WithDAGChangePolicy(policy DAGChangePolicy) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		if policy == DAGChangePolicyMigrate {
+			return fmt.Errorf("use WithDAGChangeMigration for the %s policy", policy)
+		}
+		opts.dagChangePolicy = policy
+		return nil
+	}
+}
+
+// WithDAGChangeMigration sets DAGChangePolicyMigrate.
+// fn returns the new task ID for the task ID recorded in the resumed DAGRunContext, ok is false if it is not renamed.
+func WithDAGChangeMigration(fn func(oldTaskID string) (newTaskID string, ok bool)) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		if fn == nil {
+			return fmt.Errorf("migration function is nil")
+		}
+		opts.dagChangePolicy = DAGChangePolicyMigrate
+		opts.taskIDMigration = fn
+		return nil
+	}
+}
+
+// DAGDefinitionChangedError is returned when the DAG definition is changed during a DAG run.
+// UnknownTaskIDs are finished tasks which do not exist in the DAG,
+// MissingTaskIDs are not finished tasks whose descendants have already finished.
+type DAGDefinitionChangedError struct {
+	DAGRunID       string
+	UnknownTaskIDs []string
+	MissingTaskIDs []string
+}
+
+func (err *DAGDefinitionChangedError) Error() string {
+	return fmt.Sprintf("DAG definition changed during DAG run %s: unknown tasks [%s], missing tasks [%s]",
+		err.DAGRunID, strings.Join(err.UnknownTaskIDs, ", "), strings.Join(err.MissingTaskIDs, ", "))
+}
+
+// Fingerprint returns the hash of the DAG structure, task IDs and dependencies.
+func (dag *DAG) Fingerprint() string {
+	h := sha256.New()
+	for _, task := range dag.GetAllTasks() {
+		fmt.Fprintf(h, "task:%s\n", task.ID())
+	}
+	edges := make([]string, 0)
+	dag.WarkAllDependencies(func(ancestor, descendant *Task) error {
+		edges = append(edges, fmt.Sprintf("edge:%s->%s\n", ancestor.ID(), descendant.ID()))
+		return nil
+	})
+	sort.Strings(edges)
+	for _, edge := range edges {
+		h.Write([]byte(edge))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (dag *DAG) detectDAGChange(dagRunCtx *DAGRunContext) (unknownTaskIDs []string, missingTaskIDs []string) {
+	finishedTaskIDs := lo.Keys(dagRunCtx.TaskResponses)
+	unknownTaskIDs = lo.Filter(finishedTaskIDs, func(taskID string, _ int) bool {
+		_, ok := dag.GetTask(taskID)
+		return !ok
+	})
+	sort.Strings(unknownTaskIDs)
+	missingTaskIDs = make([]string, 0)
+	for _, task := range dag.GetAllTasks() {
+		if lo.Contains(finishedTaskIDs, task.ID()) {
+			continue
+		}
+		if lo.SomeBy(dag.GetDescendantTasks(task.ID()), func(descendant *Task) bool {
+			return lo.Contains(finishedTaskIDs, descendant.ID())
+		}) {
+			missingTaskIDs = append(missingTaskIDs, task.ID())
+		}
+	}
+	return unknownTaskIDs, missingTaskIDs
+}
+
+// validateDAGRunContext compares the DAG fingerprint recorded at the start of the DAG run with the current DAG.
+func (dag *DAG) validateDAGRunContext(ctx context.Context, l *slog.Logger, dagRunCtx *DAGRunContext) error {
+	fingerprint := dag.Fingerprint()
+	if dagRunCtx.LambdaCallCount == 0 && dagRunCtx.DAGFingerprint == "" {
+		dagRunCtx.DAGFingerprint = fingerprint
+		return nil
+	}
+	if dagRunCtx.DAGFingerprint == fingerprint {
+		return nil
+	}
+	l.Warn("DAG definition changed", slog.String("old_fingerprint", dagRunCtx.DAGFingerprint), slog.String("fingerprint", fingerprint))
+	if dag.opts.dagChangePolicy == DAGChangePolicyMigrate {
+		if err := dag.migrateTaskIDs(ctx, l, dagRunCtx); err != nil {
+			return err
+		}
+	}
+	unknownTaskIDs, missingTaskIDs := dag.detectDAGChange(dagRunCtx)
+	if len(unknownTaskIDs) > 0 || len(missingTaskIDs) > 0 {
+		changedErr := &DAGDefinitionChangedError{
+			DAGRunID:       dagRunCtx.DAGRunID,
+			UnknownTaskIDs: unknownTaskIDs,
+			MissingTaskIDs: missingTaskIDs,
+		}
+		if dag.opts.dagChangePolicy == DAGChangePolicyFail {
+			return changedErr
+		}
+		l.Warn(changedErr.Error())
+	}
+	dagRunCtx.DAGFingerprint = fingerprint
+	return nil
+}
+
+func (dag *DAG) migrateTaskIDs(ctx context.Context, l *slog.Logger, dagRunCtx *DAGRunContext) error {
+	taskIDs := append(lo.Keys(dagRunCtx.TaskResponses), lo.Keys(dagRunCtx.TaskAttempts)...)
+	taskIDs = append(taskIDs, lo.Keys(dagRunCtx.TaskCallbacksFired)...)
+	renamed := make(map[string]string)
+	for _, taskID := range lo.Uniq(taskIDs) {
+		if _, ok := dag.GetTask(taskID); ok {
+			continue
+		}
+		newTaskID, ok := dag.opts.taskIDMigration(taskID)
+		if !ok {
+			continue
+		}
+		l.Info("migrate task", slog.String("old_task_id", taskID), slog.String("task_id", newTaskID))
+		renamed[taskID] = newTaskID
+	}
+	if err := dag.reencryptTaskResponses(ctx, dagRunCtx, renamed); err != nil {
+		return err
+	}
+	dagRunCtx.TaskResponses = renameTaskIDKeys(dagRunCtx.TaskResponses, renamed)
+	dagRunCtx.TaskAttempts = renameTaskIDKeys(dagRunCtx.TaskAttempts, renamed)
+	dagRunCtx.TaskCallbacksFired = renameTaskIDKeys(dagRunCtx.TaskCallbacksFired, renamed)
+	for i, ti := range dagRunCtx.TaskInstances {
+		if newTaskID, ok := renamed[ti.TaskID]; ok {
+			dagRunCtx.TaskInstances[i].TaskID = newTaskID
+		}
+	}
+	return nil
+}
+
+// reencryptTaskResponses encodes the responses of the renamed tasks again,
+// because the encrypted response is bound to the task ID.
+func (dag *DAG) reencryptTaskResponses(ctx context.Context, dagRunCtx *DAGRunContext, renamed map[string]string) error {
+	if dag.opts.keyProvider == nil {
+		return nil
+	}
+	for oldTaskID, newTaskID := range renamed {
+		data, ok := dagRunCtx.TaskResponses[oldTaskID]
+		if !ok {
+			continue
+		}
+		decoded, err := dag.decodeTaskResponse(ctx, dagRunCtx.DAGRunID, oldTaskID, data)
+		if err != nil {
+			return fmt.Errorf("task `%s` response: %w", oldTaskID, err)
+		}
+		encoded, err := dag.encodeTaskResponse(ctx, dagRunCtx, newTaskID, decoded)
+		if err != nil {
+			return fmt.Errorf("task `%s` response: %w", newTaskID, err)
+		}
+		dagRunCtx.TaskResponses[oldTaskID] = encoded
+	}
+	return nil
+}
+
+// renameTaskIDKeys returns the copy of the per-task map with the renamed task IDs.
+func renameTaskIDKeys[V any](m map[string]V, renamed map[string]string) map[string]V {
+	if m == nil {
+		return nil
+	}
+	migrated := make(map[string]V, len(m))
+	for taskID, v := range m {
+		if newTaskID, ok := renamed[taskID]; ok {
+			taskID = newTaskID
+		}
+		migrated[taskID] = v
+	}
+	return migrated
+}
@@ -0,0 +1,96 @@
+package lambdag_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+// newChainDAG creates the DAG such as task1 -> task2 -> task3, handled task IDs are recorded to handled.
+func newChainDAG(t *testing.T, taskIDs []string, handled *[]string, optFns ...func(opts *lambdag.DAGOptions) error) *lambdag.DAG {
+	t.Helper()
+	dag, err := lambdag.NewDAG("ChainDAG", optFns...)
+	require.NoError(t, err)
+	var mu sync.Mutex
+	var prev *lambdag.Task
+	for _, taskID := range taskIDs {
+		taskID := taskID
+		task, err := dag.NewTask(taskID, lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			*handled = append(*handled, taskID)
+			return taskID + " success", nil
+		}))
+		require.NoError(t, err)
+		if prev != nil {
+			require.NoError(t, prev.SetDownstream(task))
+		}
+		prev = task
+	}
+	return dag
+}
+
+func TestDAGFingerprint(t *testing.T) {
+	handled := make([]string, 0)
+	dag1 := newChainDAG(t, []string{"task1", "task2", "task3"}, &handled)
+	dag2 := newChainDAG(t, []string{"task1", "task2", "task3"}, &handled)
+	dag3 := newChainDAG(t, []string{"task1", "renamed", "task3"}, &handled)
+	require.EqualValues(t, dag1.Fingerprint(), dag2.Fingerprint())
+	require.NotEqualValues(t, dag1.Fingerprint(), dag3.Fingerprint())
+}
+
+func TestDAGChangePolicy(t *testing.T) {
+	handled := make([]string, 0)
+	oldDAG := newChainDAG(t, []string{"task1", "task2", "task3"}, &handled)
+	oldHandler := lambdag.NewLambdaHandler(oldDAG)
+	payload := []byte(`{}`)
+	for i := 0; i < 2; i++ {
+		resp, err := oldHandler.Invoke(context.Background(), payload)
+		require.NoError(t, err)
+		payload = resp
+	}
+	var dagRunCtx lambdag.DAGRunContext
+	require.NoError(t, json.Unmarshal(payload, &dagRunCtx))
+	require.EqualValues(t, oldDAG.Fingerprint(), dagRunCtx.DAGFingerprint)
+	require.EqualValues(t, []string{"task1", "task2"}, handled)
+
+	t.Run("fail", func(t *testing.T) {
+		handled := make([]string, 0)
+		newDAG := newChainDAG(t, []string{"task1", "renamed", "task3"}, &handled, lambdag.WithDAGChangePolicy(lambdag.DAGChangePolicyFail))
+		_, err := lambdag.NewLambdaHandler(newDAG).Invoke(context.Background(), payload)
+		var ive messages.InvokeResponse_Error
+		require.True(t, errors.As(err, &ive))
+		require.EqualValues(t, "LambDAG.DAGDefinitionChanged", ive.Type)
+		require.Contains(t, ive.Message, "unknown tasks [task2], missing tasks []")
+		require.Empty(t, handled)
+	})
+	t.Run("warn", func(t *testing.T) {
+		handled := make([]string, 0)
+		newDAG := newChainDAG(t, []string{"task1", "renamed", "task3"}, &handled)
+		dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(newDAG), payload)
+		require.EqualValues(t, []string{"renamed", "task3"}, handled)
+		require.EqualValues(t, newDAG.Fingerprint(), dagRunCtx.DAGFingerprint)
+	})
+	t.Run("migrate", func(t *testing.T) {
+		handled := make([]string, 0)
+		newDAG := newChainDAG(t, []string{"task1", "renamed", "task3"}, &handled, lambdag.WithDAGChangeMigration(func(oldTaskID string) (string, bool) {
+			if oldTaskID == "task2" {
+				return "renamed", true
+			}
+			return "", false
+		}))
+		dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(newDAG), payload)
+		require.EqualValues(t, []string{"task3"}, handled)
+		require.EqualValues(t, map[string]json.RawMessage{
+			"task1":   json.RawMessage(`"task1 success"`),
+			"renamed": json.RawMessage(`"task2 success"`),
+			"task3":   json.RawMessage(`"task3 success"`),
+		}, dagRunCtx.TaskResponses)
+	})
+}
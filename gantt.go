@@ -0,0 +1,170 @@
+package lambdag
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RenderMermaidGantt writes the Mermaid gantt chart of the DAG run from DAGRunContext.TaskInstances.
+// The task instances are grouped into sections by the Lambda invocation.
+func RenderMermaidGantt(w io.Writer, dagID string, dagRunCtx *DAGRunContext) error {
+	if len(dagRunCtx.TaskInstances) == 0 {
+		return fmt.Errorf("DAG run `%s` has no task instance history", dagRunCtx.DAGRunID)
+	}
+	var builder strings.Builder
+	builder.WriteString("gantt\n")
+	fmt.Fprintf(&builder, "    title %s %s", escapeMermaidGantt(dagID), dagRunCtx.DAGRunID)
+	if dagRunCtx.TaskInstancesDropped > 0 {
+		fmt.Fprintf(&builder, " (%s)", ganttTruncatedNote(dagRunCtx))
+	}
+	builder.WriteRune('\n')
+	builder.WriteString("    dateFormat x\n")
+	builder.WriteString("    axisFormat %H:%M:%S\n")
+	section := 0
+	for i, ti := range dagRunCtx.TaskInstances {
+		if ti.LambdaCallCount != section {
+			section = ti.LambdaCallCount
+			fmt.Fprintf(&builder, "    section Invocation %d", section)
+			if ti.AWSRequestID != "" {
+				fmt.Fprintf(&builder, " %s", ti.AWSRequestID)
+			}
+			builder.WriteRune('\n')
+		}
+		name := escapeMermaidGantt(ti.TaskID)
+		if ti.Attempt > 1 {
+			name = fmt.Sprintf("%s (attempt %d)", name, ti.Attempt)
+		}
+		fmt.Fprintf(&builder, "    %s :%s ti%d, %d, %d\n", name, ganttTag(ti.Outcome), i, ti.StartAt.UnixMilli(), ti.EndAt.UnixMilli())
+	}
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// ganttTruncatedNote is the note shown when the task instance history was truncated by the history limit.
+func ganttTruncatedNote(dagRunCtx *DAGRunContext) string {
+	return fmt.Sprintf("history truncated, %d older task instances dropped", dagRunCtx.TaskInstancesDropped)
+}
+
+func ganttTag(outcome string) string {
+	switch outcome {
+	case "success":
+		return "done,"
+	case "failure":
+		return "crit,"
+	case "retry":
+		return "active,"
+	}
+	return ""
+}
+
+func escapeMermaidGantt(s string) string {
+	return strings.NewReplacer(":", "_", "#", "_", ";", "_", "\n", " ").Replace(s)
+}
+
+var ganttHTMLTemplate = template.Must(template.New("gantt").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .DAGID }} {{ .DAGRunContext.DAGRunID }}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.truncated { color: #b00020; font-weight: bold; }
+.chart td.bar { width: 600px; padding: 4px 0; }
+.chart .span { position: relative; height: 16px; }
+.chart .span div { position: absolute; height: 16px; min-width: 2px; }
+.success { background: #4caf50; }
+.retry { background: #ff9800; }
+.failure { background: #e53935; }
+</style>
+</head>
+<body>
+<h1>{{ .DAGID }}</h1>
+<p>DAG run {{ .DAGRunContext.DAGRunID }} started at {{ .DAGRunContext.DAGRunStartAt.Format "2006-01-02T15:04:05.000Z07:00" }}, {{ .DAGRunContext.LambdaCallCount }} Lambda invocations</p>
+{{- if .Truncated }}
+<p class="truncated">{{ .Truncated }}</p>
+{{- end }}
+<table class="chart">
+{{- range .Bars }}
+<tr><td>{{ .Label }}</td><td class="bar"><div class="span"><div class="{{ .Outcome }}" style="left: {{ .Left }}%; width: {{ .Width }}%"></div></div></td></tr>
+{{- end }}
+</table>
+<table>
+<tr><th>Task</th><th>Attempt</th><th>Invocation</th><th>Request ID</th><th>Start</th><th>Duration (ms)</th><th>Outcome</th><th>Error</th></tr>
+{{- range .DAGRunContext.TaskInstances }}
+<tr><td>{{ .TaskID }}</td><td>{{ .Attempt }}</td><td>{{ .LambdaCallCount }}</td><td>{{ .AWSRequestID }}</td><td>{{ .StartAt.Format "15:04:05.000" }}</td><td>{{ .DurationMillis }}</td><td>{{ .Outcome }}</td><td>{{ .Error }}</td></tr>
+{{- end }}
+</table>
+<details>
+<summary>Mermaid gantt chart</summary>
+<pre>
+{{ .Gantt }}
+</pre>
+</details>
+</body>
+</html>
+`))
+
+type ganttBar struct {
+	Label   string
+	Outcome string
+	Left    string
+	Width   string
+}
+
+// ganttBars lays out the task instances on the timeline from the first start to the last end, in percent.
+func ganttBars(dagRunCtx *DAGRunContext) []ganttBar {
+	start, end := dagRunCtx.TaskInstances[0].StartAt, dagRunCtx.TaskInstances[0].EndAt
+	for _, ti := range dagRunCtx.TaskInstances {
+		if ti.StartAt.Before(start) {
+			start = ti.StartAt
+		}
+		if ti.EndAt.After(end) {
+			end = ti.EndAt
+		}
+	}
+	total := float64(end.Sub(start))
+	bars := make([]ganttBar, 0, len(dagRunCtx.TaskInstances))
+	for _, ti := range dagRunCtx.TaskInstances {
+		left, width := 0.0, 100.0
+		if total > 0 {
+			left = float64(ti.StartAt.Sub(start)) / total * 100
+			width = float64(ti.Duration()) / total * 100
+		}
+		label := ti.TaskID
+		if ti.Attempt > 1 {
+			label = fmt.Sprintf("%s (attempt %d)", label, ti.Attempt)
+		}
+		bars = append(bars, ganttBar{
+			Label:   label,
+			Outcome: ti.Outcome,
+			Left:    strconv.FormatFloat(left, 'f', 2, 64),
+			Width:   strconv.FormatFloat(width, 'f', 2, 64),
+		})
+	}
+	return bars
+}
+
+// RenderGanttHTML writes the HTML page of the gantt chart and the task instance table of the DAG run.
+// The chart is laid out here, and the page does not load any external resources, so that it works offline.
+func RenderGanttHTML(w io.Writer, dagID string, dagRunCtx *DAGRunContext) error {
+	var gantt strings.Builder
+	if err := RenderMermaidGantt(&gantt, dagID, dagRunCtx); err != nil {
+		return err
+	}
+	var truncated string
+	if dagRunCtx.TaskInstancesDropped > 0 {
+		truncated = ganttTruncatedNote(dagRunCtx)
+	}
+	return ganttHTMLTemplate.Execute(w, map[string]interface{}{
+		"DAGID":         dagID,
+		"DAGRunContext": dagRunCtx,
+		"Gantt":         gantt.String(),
+		"Bars":          ganttBars(dagRunCtx),
+		"Truncated":     truncated,
+	})
+}
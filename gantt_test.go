@@ -0,0 +1,67 @@
+package lambdag_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func newGanttTestDAGRunContext() *lambdag.DAGRunContext {
+	start := time.Date(2022, 06, 19, 9, 00, 00, 0, time.UTC)
+	return &lambdag.DAGRunContext{
+		DAGRunID:        "test-run",
+		DAGRunStartAt:   start,
+		LambdaCallCount: 2,
+		TaskInstances: []lambdag.TaskInstance{
+			{TaskID: "task1", Attempt: 1, LambdaCallCount: 1, AWSRequestID: "req-1", StartAt: start, EndAt: start.Add(time.Second), DurationMillis: 1000, Outcome: "success"},
+			{TaskID: "task2", Attempt: 1, LambdaCallCount: 2, AWSRequestID: "req-2", StartAt: start.Add(2 * time.Second), EndAt: start.Add(3 * time.Second), DurationMillis: 1000, Outcome: "retry", Error: "<retry>"},
+			{TaskID: "task:3", Attempt: 2, LambdaCallCount: 2, AWSRequestID: "req-2", StartAt: start.Add(2 * time.Second), EndAt: start.Add(4 * time.Second), DurationMillis: 2000, Outcome: "failure"},
+		},
+	}
+}
+
+func TestRenderMermaidGantt(t *testing.T) {
+	var builder strings.Builder
+	require.NoError(t, lambdag.RenderMermaidGantt(&builder, "SampleDAG", newGanttTestDAGRunContext()))
+	expected := `gantt
+    title SampleDAG test-run
+    dateFormat x
+    axisFormat %H:%M:%S
+    section Invocation 1 req-1
+    task1 :done, ti0, 1655629200000, 1655629201000
+    section Invocation 2 req-2
+    task2 :active, ti1, 1655629202000, 1655629203000
+    task_3 (attempt 2) :crit, ti2, 1655629202000, 1655629204000
+`
+	require.EqualValues(t, expected, builder.String())
+
+	err := lambdag.RenderMermaidGantt(&builder, "SampleDAG", &lambdag.DAGRunContext{DAGRunID: "empty-run"})
+	require.EqualError(t, err, "DAG run `empty-run` has no task instance history")
+}
+
+func TestRenderGanttHTML(t *testing.T) {
+	var builder strings.Builder
+	require.NoError(t, lambdag.RenderGanttHTML(&builder, "SampleDAG", newGanttTestDAGRunContext()))
+	html := builder.String()
+	require.Contains(t, html, `<tr><td>task1</td><td class="bar"><div class="span"><div class="success" style="left: 0.00%; width: 25.00%"></div></div></td></tr>`)
+	require.Contains(t, html, `<tr><td>task:3 (attempt 2)</td><td class="bar"><div class="span"><div class="failure" style="left: 50.00%; width: 50.00%"></div></div></td></tr>`)
+	require.Contains(t, html, "task1 :done, ti0, 1655629200000, 1655629201000")
+	require.Contains(t, html, "<td>task2</td><td>1</td><td>2</td><td>req-2</td><td>09:00:02.000</td><td>1000</td><td>retry</td><td>&lt;retry&gt;</td>")
+	require.NotContains(t, html, "<script", "the page works offline")
+	require.NotContains(t, html, "history truncated")
+}
+
+func TestRenderGanttTruncated(t *testing.T) {
+	dagRunCtx := newGanttTestDAGRunContext()
+	dagRunCtx.TaskInstancesDropped = 5
+	var builder strings.Builder
+	require.NoError(t, lambdag.RenderMermaidGantt(&builder, "SampleDAG", dagRunCtx))
+	require.True(t, strings.HasPrefix(builder.String(), "gantt\n    title SampleDAG test-run (history truncated, 5 older task instances dropped)\n"))
+
+	builder.Reset()
+	require.NoError(t, lambdag.RenderGanttHTML(&builder, "SampleDAG", dagRunCtx))
+	require.Contains(t, builder.String(), `<p class="truncated">history truncated, 5 older task instances dropped</p>`)
+}
@@ -0,0 +1,94 @@
+package lambdag
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+const (
+	defaultTaskInstanceHistoryLimit = 100
+	taskInstanceErrorMaxBytes       = 256
+)
+
+// TaskInstance is the record of a task execution in the DAG run.
+type TaskInstance struct {
+	TaskID          string    `json:"TaskId"`
+	Attempt         int       `json:"Attempt"`
+	LambdaCallCount int       `json:"LambdaCallCount"`
+	AWSRequestID    string    `json:"AwsRequestId,omitempty"`
+	StartAt         time.Time `json:"StartAt"`
+	EndAt           time.Time `json:"EndAt"`
+	DurationMillis  int64     `json:"DurationMillis"`
+	// Outcome is success, retry or failure.
+	Outcome string `json:"Outcome"`
+	Error   string `json:"Error,omitempty"`
+}
+
+func (ti TaskInstance) Duration() time.Duration {
+	return ti.EndAt.Sub(ti.StartAt)
+}
+
+// WithTaskInstanceHistoryLimit sets the max number of TaskInstances kept in DAGRunContext, the oldest ones are dropped.
+// The default is 100, and the negative limit disables the history.
+func WithTaskInstanceHistoryLimit(limit int) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		opts.taskInstanceHistoryLimit = limit
+		return nil
+	}
+}
+
+func (dag *DAG) TaskInstanceHistoryLimit() int {
+	if dag.opts.taskInstanceHistoryLimit == 0 {
+		return defaultTaskInstanceHistoryLimit
+	}
+	if dag.opts.taskInstanceHistoryLimit < 0 {
+		return 0
+	}
+	return dag.opts.taskInstanceHistoryLimit
+}
+
+func newTaskInstance(ctx context.Context, dagRunCtx *DAGRunContext, taskID string, startAt time.Time, endAt time.Time, err error) TaskInstance {
+	ti := TaskInstance{
+		TaskID:          taskID,
+		Attempt:         dagRunCtx.TaskAttempts[taskID],
+		LambdaCallCount: dagRunCtx.LambdaCallCount,
+		StartAt:         startAt,
+		EndAt:           endAt,
+		DurationMillis:  endAt.Sub(startAt).Milliseconds(),
+		Outcome:         taskOutcome(err),
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		ti.AWSRequestID = lc.AwsRequestID
+	}
+	if err != nil {
+		ti.Error = truncateString(err.Error(), taskInstanceErrorMaxBytes)
+	}
+	return ti
+}
+
+func (dag *DAG) appendTaskInstances(dagRunCtx *DAGRunContext, instances ...TaskInstance) {
+	limit := dag.TaskInstanceHistoryLimit()
+	if limit == 0 {
+		return
+	}
+	dagRunCtx.TaskInstances = append(dagRunCtx.TaskInstances, instances...)
+	if over := len(dagRunCtx.TaskInstances) - limit; over > 0 {
+		dagRunCtx.TaskInstances = append([]TaskInstance(nil), dagRunCtx.TaskInstances[over:]...)
+		dagRunCtx.TaskInstancesDropped += over
+	}
+}
+
+func truncateString(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	const ellipsis = "..."
+	trimmed := s[:maxBytes-len(ellipsis)]
+	for !utf8.ValidString(trimmed) {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	return trimmed + ellipsis
+}
@@ -0,0 +1,82 @@
+package lambdag_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskInstanceHistory(t *testing.T) {
+	var instancesInCallback []lambdag.TaskInstance
+	dag, err := lambdag.NewDAG("HistoryDAG", lambdag.WithNumOfTasksInSingleInvoke(2))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		if tr.Attempt < 3 {
+			return nil, lambdag.WrapTaskRetryable(errors.New(strings.Repeat("x", 300)))
+		}
+		return "task1 success", nil
+	}), lambdag.WithOnTaskSuccess(func(ctx context.Context, dagRunCtx *lambdag.DAGRunContext, taskID string, err error) {
+		instancesInCallback = append(instancesInCallback, dagRunCtx.TaskInstances...)
+	}))
+	require.NoError(t, err)
+
+	dagRunCtx := &lambdag.DAGRunContext{DAGRunID: "test-run"}
+	for i := 0; i < 3; i++ {
+		ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+			AwsRequestID: []string{"req-1", "req-2", "req-3"}[i],
+		})
+		dagRunCtx, err = dag.Execute(ctx, dagRunCtx)
+		var mte *lambdag.MultiTaskError
+		if err != nil {
+			require.True(t, errors.As(err, &mte))
+			require.True(t, mte.IsRetryable())
+		}
+	}
+	require.Len(t, dagRunCtx.TaskInstances, 3)
+	for i, ti := range dagRunCtx.TaskInstances {
+		require.EqualValues(t, "task1", ti.TaskID)
+		require.EqualValues(t, i+1, ti.Attempt)
+		require.EqualValues(t, i+1, ti.LambdaCallCount)
+		require.EqualValues(t, []string{"req-1", "req-2", "req-3"}[i], ti.AWSRequestID)
+		require.EqualValues(t, []string{"retry", "retry", "success"}[i], ti.Outcome)
+		require.EqualValues(t, ti.Duration().Milliseconds(), ti.DurationMillis)
+	}
+	require.Len(t, dagRunCtx.TaskInstances[0].Error, 256)
+	require.True(t, strings.HasSuffix(dagRunCtx.TaskInstances[0].Error, "..."))
+	require.Empty(t, dagRunCtx.TaskInstances[2].Error)
+	require.EqualValues(t, dagRunCtx.TaskInstances, instancesInCallback)
+
+	bs, err := json.Marshal(dagRunCtx)
+	require.NoError(t, err)
+	decoded, err := lambdag.DecodeDAGRunContext(bs)
+	require.NoError(t, err)
+	require.Len(t, decoded.TaskInstances, 3)
+}
+
+func TestTaskInstanceHistoryLimit(t *testing.T) {
+	cases := []struct {
+		limit    int
+		expected []string
+		dropped  int
+	}{
+		{limit: 2, expected: []string{"task2", "task3"}, dropped: 1},
+		{limit: -1, expected: nil, dropped: 0},
+	}
+	for _, c := range cases {
+		handled := make([]string, 0)
+		dag := newChainDAG(t, []string{"task1", "task2", "task3"}, &handled, lambdag.WithTaskInstanceHistoryLimit(c.limit))
+		dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+		var taskIDs []string
+		for _, ti := range dagRunCtx.TaskInstances {
+			taskIDs = append(taskIDs, ti.TaskID)
+		}
+		require.EqualValues(t, c.expected, taskIDs)
+		require.EqualValues(t, c.dropped, dagRunCtx.TaskInstancesDropped)
+	}
+}
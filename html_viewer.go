@@ -0,0 +1,381 @@
+package lambdag
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+)
+
+const (
+	htmlViewerMargin     = 40
+	htmlViewerNodeHeight = 40
+	htmlViewerRowGap     = 30
+	htmlViewerLayerGap   = 80
+)
+
+type htmlViewerNode struct {
+	TaskID  string
+	Tooltip string
+	X, Y    int
+	Width   int
+	Height  int
+	Fill    string
+}
+
+type htmlViewerEdge struct {
+	From, To string
+	Path     string
+}
+
+type htmlViewerTask struct {
+	State       TaskState         `json:"State,omitempty"`
+	Description string            `json:"Description,omitempty"`
+	Owner       string            `json:"Owner,omitempty"`
+	Tags        []string          `json:"Tags,omitempty"`
+	Docs        string            `json:"Docs,omitempty"`
+	Links       []TaskLink        `json:"Links,omitempty"`
+	Upstream    []string          `json:"Upstream"`
+	Downstream  []string          `json:"Downstream"`
+	Ancestors   []string          `json:"Ancestors"`
+	Descendants []string          `json:"Descendants"`
+	Options     []htmlViewerValue `json:"Options"`
+}
+
+type htmlViewerValue struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+// renderHTML writes the single HTML file of the interactive DAG viewer.
+// The graph is laid out here as SVG, and the page does not load any external resources, so that it works offline.
+func renderHTML(w io.Writer, dag *DAG, opts RenderOptions) error {
+	tasksByLayer := opts.taskLayers(dag)
+	nodeWidth := 140
+	for _, task := range opts.Tasks(dag) {
+		if width := len(task.ID())*8 + 24; width > nodeWidth {
+			nodeWidth = width
+		}
+	}
+	nodes := make([]htmlViewerNode, 0)
+	positions := make(map[string]htmlViewerNode)
+	width, height := 0, 0
+	for i, tasks := range tasksByLayer {
+		for j, task := range tasks {
+			node := htmlViewerNode{
+				TaskID:  task.ID(),
+				Tooltip: task.metadataSummary(),
+				X:       htmlViewerMargin + i*(nodeWidth+htmlViewerLayerGap),
+				Y:       htmlViewerMargin + j*(htmlViewerNodeHeight+htmlViewerRowGap),
+				Width:   nodeWidth,
+				Height:  htmlViewerNodeHeight,
+				Fill:    taskStateColors[TaskStatePending],
+			}
+			if state, ok := opts.TaskStates[task.ID()]; ok {
+				node.Fill = taskStateColors[state]
+			}
+			nodes = append(nodes, node)
+			positions[task.ID()] = node
+			if right := node.X + node.Width + htmlViewerMargin; right > width {
+				width = right
+			}
+			if bottom := node.Y + node.Height + htmlViewerMargin; bottom > height {
+				height = bottom
+			}
+		}
+	}
+	edges := make([]htmlViewerEdge, 0)
+	upstreams := make(map[string][]string)
+	downstreams := make(map[string][]string)
+	for _, task := range opts.Tasks(dag) {
+		upstreams[task.ID()] = make([]string, 0)
+		downstreams[task.ID()] = make([]string, 0)
+	}
+	if err := opts.WarkDependencies(dag, func(ancestor, descendant *Task) error {
+		upstreams[descendant.ID()] = append(upstreams[descendant.ID()], ancestor.ID())
+		downstreams[ancestor.ID()] = append(downstreams[ancestor.ID()], descendant.ID())
+		from, to := positions[ancestor.ID()], positions[descendant.ID()]
+		x1, y1 := from.X+from.Width, from.Y+from.Height/2
+		x2, y2 := to.X, to.Y+to.Height/2
+		edges = append(edges, htmlViewerEdge{
+			From: ancestor.ID(),
+			To:   descendant.ID(),
+			Path: fmt.Sprintf("M%d,%d C%d,%d %d,%d %d,%d", x1, y1, (x1+x2)/2, y1, (x1+x2)/2, y2, x2, y2),
+		})
+		return nil
+	}); err != nil {
+		return err
+	}
+	tasks := make(map[string]htmlViewerTask)
+	for _, task := range opts.Tasks(dag) {
+		tasks[task.ID()] = htmlViewerTask{
+			State:       opts.TaskStates[task.ID()],
+			Description: task.Description(),
+			Owner:       task.Owner(),
+			Tags:        task.Tags(),
+			Docs:        task.Docs(),
+			Links:       task.Links(),
+			Upstream:    upstreams[task.ID()],
+			Downstream:  downstreams[task.ID()],
+			Ancestors:   taskIDs(opts.filterTasks(dag.GetAncestorTasks(task.ID()))),
+			Descendants: taskIDs(opts.filterTasks(dag.GetDescendantTasks(task.ID()))),
+			Options:     task.viewerOptions(),
+		}
+	}
+	return htmlViewerTemplate.Execute(w, map[string]interface{}{
+		"DAGID":  dag.ID(),
+		"Width":  width,
+		"Height": height,
+		"Nodes":  nodes,
+		"Edges":  edges,
+		"Tasks":  tasks,
+		"Colors": taskStateColors,
+	})
+}
+
+func taskIDs(tasks []*Task) []string {
+	ids := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID())
+	}
+	return ids
+}
+
+// viewerOptions returns the options of the task shown in the HTML viewer.
+func (task *Task) viewerOptions() []htmlViewerValue {
+	locker := "none"
+	if task.opts.newLockerFunc != nil {
+		locker = "custom"
+	}
+	logger := "DAG"
+	if task.opts.newLoggerFunc != nil || task.opts.newSloggerFunc != nil {
+		logger = "custom"
+	}
+	return []htmlViewerValue{
+		{Name: "ResponseCodec", Value: fmt.Sprintf("%T", task.ResponseCodec())},
+		{Name: "Locker", Value: locker},
+		{Name: "Logger", Value: logger},
+		{Name: "Middlewares", Value: strconv.Itoa(len(task.opts.middlewares))},
+		{Name: "Callbacks", Value: fmt.Sprintf("success %d, failure %d, retry %d", len(task.opts.onSuccess), len(task.opts.onFailure), len(task.opts.onRetry))},
+	}
+}
+
+var htmlViewerTemplate = template.Must(template.New("viewer").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .DAGID }}</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+#graph { flex: 1; overflow: hidden; position: relative; border-right: 1px solid #ccc; }
+#graph svg { width: 100%; height: 100%; cursor: grab; }
+#controls { position: absolute; top: 8px; left: 8px; }
+#controls button { width: 32px; height: 32px; }
+#panel { width: 320px; padding: 8px 16px; overflow-y: auto; }
+.node rect { stroke: #555; stroke-width: 1; rx: 6; cursor: pointer; }
+.node text { font-size: 13px; pointer-events: none; }
+.edge { fill: none; stroke: #999; stroke-width: 1.5; marker-end: url(#arrow); }
+.dimmed { opacity: 0.25; }
+.node.selected rect { stroke: #000; stroke-width: 3; }
+.node.upstream rect, .edge.upstream { stroke: #1f6feb; stroke-width: 2.5; }
+.node.downstream rect, .edge.downstream { stroke: #d97706; stroke-width: 2.5; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+ul { padding-left: 20px; }
+a { cursor: pointer; color: #1f6feb; }
+pre { white-space: pre-wrap; background: #f6f8fa; padding: 8px; }
+.tag { display: inline-block; background: #eee; border-radius: 8px; padding: 0 8px; margin-right: 4px; }
+</style>
+</head>
+<body>
+<div id="graph">
+<div id="controls"><button id="zoom-in">+</button> <button id="zoom-out">-</button> <button id="zoom-reset">1:1</button></div>
+<svg id="svg" viewBox="0 0 {{ .Width }} {{ .Height }}" xmlns="http://www.w3.org/2000/svg">
+<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z" fill="#999"/></marker></defs>
+{{- range .Edges }}
+<path class="edge" data-from="{{ .From }}" data-to="{{ .To }}" d="{{ .Path }}"/>
+{{- end }}
+{{- range .Nodes }}
+<g class="node" data-task="{{ .TaskID }}">{{ if .Tooltip }}<title>{{ .Tooltip }}</title>{{ end }}<rect x="{{ .X }}" y="{{ .Y }}" width="{{ .Width }}" height="{{ .Height }}" fill="{{ .Fill }}"/><text x="{{ .X }}" y="{{ .Y }}" dx="12" dy="25">{{ .TaskID }}</text></g>
+{{- end }}
+</svg>
+</div>
+<div id="panel">
+<h1>{{ .DAGID }}</h1>
+<p>Click a task to see its upstream and downstream tasks. Scroll to zoom, drag to pan.</p>
+<div id="detail"></div>
+</div>
+<script>
+const tasks = {{ .Tasks }};
+const colors = {{ .Colors }};
+const svg = document.getElementById("svg");
+const initialViewBox = svg.viewBox.baseVal;
+let view = { x: initialViewBox.x, y: initialViewBox.y, width: initialViewBox.width, height: initialViewBox.height };
+const initialView = Object.assign({}, view);
+
+function applyView() {
+  svg.setAttribute("viewBox", view.x + " " + view.y + " " + view.width + " " + view.height);
+}
+
+function zoom(factor, cx, cy) {
+  if (cx === undefined) {
+    cx = view.x + view.width / 2;
+    cy = view.y + view.height / 2;
+  }
+  view.x = cx - (cx - view.x) * factor;
+  view.y = cy - (cy - view.y) * factor;
+  view.width *= factor;
+  view.height *= factor;
+  applyView();
+}
+
+function toSVGPoint(event) {
+  const rect = svg.getBoundingClientRect();
+  return {
+    x: view.x + (event.clientX - rect.left) / rect.width * view.width,
+    y: view.y + (event.clientY - rect.top) / rect.height * view.height,
+  };
+}
+
+svg.addEventListener("wheel", function (event) {
+  event.preventDefault();
+  const p = toSVGPoint(event);
+  zoom(event.deltaY > 0 ? 1.1 : 1 / 1.1, p.x, p.y);
+}, { passive: false });
+
+let drag = null;
+svg.addEventListener("mousedown", function (event) {
+  drag = { x: event.clientX, y: event.clientY, view: Object.assign({}, view) };
+});
+window.addEventListener("mousemove", function (event) {
+  if (!drag) {
+    return;
+  }
+  const rect = svg.getBoundingClientRect();
+  view.x = drag.view.x - (event.clientX - drag.x) / rect.width * view.width;
+  view.y = drag.view.y - (event.clientY - drag.y) / rect.height * view.height;
+  applyView();
+});
+window.addEventListener("mouseup", function () {
+  drag = null;
+});
+document.getElementById("zoom-in").addEventListener("click", function () { zoom(1 / 1.25); });
+document.getElementById("zoom-out").addEventListener("click", function () { zoom(1.25); });
+document.getElementById("zoom-reset").addEventListener("click", function () {
+  view = Object.assign({}, initialView);
+  applyView();
+});
+
+function element(tag, text) {
+  const el = document.createElement(tag);
+  if (text !== undefined) {
+    el.textContent = text;
+  }
+  return el;
+}
+
+function taskList(title, taskIDs) {
+  const fragment = document.createDocumentFragment();
+  fragment.appendChild(element("h3", title));
+  if (taskIDs.length === 0) {
+    fragment.appendChild(element("p", "none"));
+    return fragment;
+  }
+  const ul = element("ul");
+  taskIDs.forEach(function (taskID) {
+    const li = element("li");
+    const a = element("a", taskID);
+    a.addEventListener("click", function () { selectTask(taskID); });
+    li.appendChild(a);
+    ul.appendChild(li);
+  });
+  fragment.appendChild(ul);
+  return fragment;
+}
+
+function selectTask(taskID) {
+  const task = tasks[taskID];
+  const upstream = new Set(task.Ancestors);
+  const downstream = new Set(task.Descendants);
+  document.querySelectorAll(".node").forEach(function (node) {
+    const id = node.dataset.task;
+    node.classList.toggle("selected", id === taskID);
+    node.classList.toggle("upstream", upstream.has(id));
+    node.classList.toggle("downstream", downstream.has(id));
+    node.classList.toggle("dimmed", id !== taskID && !upstream.has(id) && !downstream.has(id));
+  });
+  document.querySelectorAll(".edge").forEach(function (edge) {
+    const from = edge.dataset.from;
+    const to = edge.dataset.to;
+    const isUpstream = upstream.has(from) && (to === taskID || upstream.has(to));
+    const isDownstream = downstream.has(to) && (from === taskID || downstream.has(from));
+    edge.classList.toggle("upstream", isUpstream);
+    edge.classList.toggle("downstream", isDownstream);
+    edge.classList.toggle("dimmed", !isUpstream && !isDownstream);
+  });
+
+  const detail = document.getElementById("detail");
+  detail.replaceChildren();
+  detail.appendChild(element("h2", taskID));
+  if (task.State) {
+    const state = element("p", "State: " + task.State);
+    state.style.background = colors[task.State];
+    detail.appendChild(state);
+  }
+  if (task.Description) {
+    detail.appendChild(element("p", task.Description));
+  }
+  if (task.Owner) {
+    detail.appendChild(element("p", "Owner: " + task.Owner));
+  }
+  if (task.Tags) {
+    const tags = element("p");
+    task.Tags.forEach(function (tag) {
+      const span = element("span", tag);
+      span.className = "tag";
+      tags.appendChild(span);
+    });
+    detail.appendChild(tags);
+  }
+  if (task.Links) {
+    detail.appendChild(element("h3", "Links"));
+    const ul = element("ul");
+    task.Links.forEach(function (link) {
+      const li = element("li");
+      if (/^https?:\/\//.test(link.URL)) {
+        const a = element("a", link.Title || link.URL);
+        a.href = link.URL;
+        a.target = "_blank";
+        a.rel = "noopener";
+        li.appendChild(a);
+      } else {
+        li.textContent = (link.Title ? link.Title + ": " : "") + link.URL;
+      }
+      ul.appendChild(li);
+    });
+    detail.appendChild(ul);
+  }
+  if (task.Docs) {
+    detail.appendChild(element("h3", "Docs"));
+    detail.appendChild(element("pre", task.Docs));
+  }
+  detail.appendChild(taskList("Upstream", task.Upstream));
+  detail.appendChild(taskList("Downstream", task.Downstream));
+  detail.appendChild(element("h3", "Options"));
+  const table = element("table");
+  task.Options.forEach(function (option) {
+    const tr = element("tr");
+    tr.appendChild(element("th", option.Name));
+    tr.appendChild(element("td", option.Value));
+    table.appendChild(tr);
+  });
+  detail.appendChild(table);
+}
+
+document.querySelectorAll(".node").forEach(function (node) {
+  node.addEventListener("click", function () { selectTask(node.dataset.task); });
+});
+</script>
+</body>
+</html>
+`))
@@ -11,6 +11,8 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-lambda-go/lambda/messages"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type LambdaHandler struct {
@@ -25,55 +27,248 @@ func NewLambdaHandler(dag *DAG) lambda.Handler {
 }
 
 type DAGRunContext struct {
-	DAGRunID        string                     `json:"DAGRunId"`
-	DAGRunStartAt   time.Time                  `json:"DAGRunStartAt"`
-	DAGRunConfig    json.RawMessage            `json:"DAGRunConfig"`
-	TaskResponses   map[string]json.RawMessage `json:"TaskResponses,omitempty"`
-	LambdaCallCount int                        `json:"LambdaCallCount"`
-	Continue        bool                       `json:"Continue"`
-	IsCircuitBreak  bool                       `json:"IsCircuitBreak"`
+	SchemaVersion  int                        `json:"SchemaVersion"`
+	DAGRunID       string                     `json:"DAGRunId"`
+	DAGRunStartAt  time.Time                  `json:"DAGRunStartAt"`
+	DAGRunConfig   json.RawMessage            `json:"DAGRunConfig"`
+	DAGFingerprint string                     `json:"DAGFingerprint,omitempty"`
+	TaskResponses  map[string]json.RawMessage `json:"TaskResponses,omitempty"`
+	TaskAttempts   map[string]int             `json:"TaskAttempts,omitempty"`
+	// TaskCallbacksFired and DAGRunCallbacksFired record the lifecycle events already notified to the callbacks.
+	TaskCallbacksFired   map[string][]string `json:"TaskCallbacksFired,omitempty"`
+	DAGRunCallbacksFired []string            `json:"DAGRunCallbacksFired,omitempty"`
+	// TaskInstances is the history of the task executions, in the order of the execution.
+	TaskInstances []TaskInstance `json:"TaskInstances,omitempty"`
+	// TaskInstancesDropped is the number of the oldest TaskInstances dropped by the history limit.
+	TaskInstancesDropped int `json:"TaskInstancesDropped,omitempty"`
+	// TraceContext is the W3C trace context of the root span of the DAG run.
+	TraceContext map[string]string `json:"TraceContext,omitempty"`
+	// pendingCallbacks are the lifecycle callbacks queued by the execution, not invoked yet.
+	pendingCallbacks []func(ctx context.Context)
+	// RetryReferenceVersion is the version of DAGRunReference that the retry of the failed invocation replays,
+	// set when DAGRunStateStore saves the state of the failed invocation.
+	RetryReferenceVersion *int64 `json:"RetryReferenceVersion,omitempty"`
+	LambdaCallCount       int    `json:"LambdaCallCount"`
+	Continue              bool   `json:"Continue"`
+	IsCircuitBreak        bool   `json:"IsCircuitBreak"`
+	Signature             string `json:"Signature,omitempty"`
 }
 
 func (h *LambdaHandler) Invoke(ctx context.Context, payload json.RawMessage) (interface{}, error) {
-	var dagRunCtx DAGRunContext
-	if err := json.Unmarshal(payload, &dagRunCtx); err != nil || dagRunCtx.DAGRunID == "" {
-		dagRunCtx.DAGRunConfig = payload
-		dagRunCtx.TaskResponses = make(map[string]json.RawMessage)
-		uuidObj, err := uuid.NewRandom()
+	defer func() {
+		if err := h.dag.flushTraces(ctx); err != nil {
+			otel.Handle(err)
+		}
+	}()
+	if store := h.dag.DAGRunStateStore(); store != nil {
+		return h.invokeWithStateStore(ctx, store, payload)
+	}
+	var dagRunCtx *DAGRunContext
+	var err error
+	if !isDAGRunContextPayload(payload) {
+		dagRunCtx, err = newDAGRunContext(payload)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dagRunCtx, err = DecodeDAGRunContext(payload)
 		if err != nil {
+			var use *UnsupportedSchemaVersionError
+			if errors.As(err, &use) {
+				return nil, messages.InvokeResponse_Error{
+					Message: use.Error(),
+					Type:    "LambDAG.UnsupportedSchemaVersion",
+				}
+			}
 			return nil, err
 		}
-		dagRunCtx.DAGRunID = uuidObj.String()
-		dagRunCtx.DAGRunStartAt = flextime.Now()
-		dagRunCtx.LambdaCallCount = 0
+		if err := h.dag.verifyDAGRunContext(ctx, dagRunCtx, payload); err != nil {
+			var se *DAGRunContextSignatureError
+			if errors.As(err, &se) {
+				return nil, messages.InvokeResponse_Error{
+					Message: se.Error(),
+					Type:    "LambDAG.SignatureInvalid",
+				}
+			}
+			return nil, err
+		}
+	}
+	updatedDAGRunCtx, err := h.execute(ctx, dagRunCtx)
+	if updatedDAGRunCtx == nil || err != nil {
+		h.dag.invokeCallbacks(ctx, dagRunCtx)
+		if updatedDAGRunCtx == nil {
+			return nil, err
+		}
+		return updatedDAGRunCtx, err
 	}
-	updatedDAGRunCtx, err := h.dag.Execute(ctx, &dagRunCtx)
+	// the lifecycle callbacks are invoked after the response is final, not invoked if the response is rejected.
+	if err := h.finalizeResponse(ctx, updatedDAGRunCtx); err != nil {
+		h.dag.discardCallbacks(dagRunCtx)
+		return nil, err
+	}
+	h.dag.invokeCallbacks(ctx, dagRunCtx)
+	return updatedDAGRunCtx, nil
+}
+
+// finalizeResponse signs DAGRunContext and checks the size of the response payload.
+func (h *LambdaHandler) finalizeResponse(ctx context.Context, dagRunCtx *DAGRunContext) error {
+	if err := h.dag.signDAGRunContext(ctx, dagRunCtx); err != nil {
+		return err
+	}
+	if err := h.checkPayloadSize(ctx, dagRunCtx); err != nil {
+		var ptle *PayloadTooLargeError
+		if errors.As(err, &ptle) {
+			return messages.InvokeResponse_Error{
+				Message: ptle.Error(),
+				Type:    "LambDAG.PayloadTooLarge",
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func newDAGRunContext(payload json.RawMessage) (*DAGRunContext, error) {
+	uuidObj, err := uuid.NewRandom()
 	if err != nil {
-		var tre *TaskRetryableError
-		if errors.As(err, &tre) {
-			if h.dag.NumOfTasksInSingleInvoke() > 1 {
-				updatedDAGRunCtx.Continue = true
-				return updatedDAGRunCtx, nil
+		return nil, err
+	}
+	return &DAGRunContext{
+		SchemaVersion:   DAGRunContextSchemaVersion,
+		DAGRunID:        uuidObj.String(),
+		DAGRunStartAt:   flextime.Now(),
+		DAGRunConfig:    payload,
+		TaskResponses:   make(map[string]json.RawMessage),
+		LambdaCallCount: 0,
+	}, nil
+}
+
+// invokeWithStateStore loads DAGRunContext from the store, and returns DAGRunReference instead of DAGRunContext.
+// DAGRunContext is saved even if the execution failed, so that finished tasks are not executed again on retry.
+// The lifecycle callbacks are invoked after DAGRunContext is saved, and are not invoked if saving failed.
+// The reference must be the latest one: the reference of the stored version,
+// or the reference replayed by the retry of the failed invocation. Stale references are rejected.
+// The first invocation has no reference to replay, so it continues the DAG run instead of failing with LambDAG.Retryable.
+func (h *LambdaHandler) invokeWithStateStore(ctx context.Context, store DAGRunStateStore, payload json.RawMessage) (interface{}, error) {
+	var ref DAGRunReference
+	var dagRunCtx *DAGRunContext
+	var version int64
+	if !isDAGRunContextPayload(payload) {
+		var err error
+		dagRunCtx, err = newDAGRunContext(payload)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := json.Unmarshal(payload, &ref); err != nil {
+			return nil, err
+		}
+		var err error
+		dagRunCtx, version, err = store.LoadDAGRunContext(ctx, ref.DAGRunID)
+		if err != nil {
+			return nil, err
+		}
+		retry := dagRunCtx.RetryReferenceVersion
+		if ref.Version != version && (retry == nil || ref.Version != *retry) {
+			return nil, messages.InvokeResponse_Error{
+				Message: fmt.Sprintf("dag run state `%s` does not match the payload: stored version %d, payload version %d", ref.DAGRunID, version, ref.Version),
+				Type:    "LambDAG.StateConflict",
 			}
+		}
+	}
+	_, execErr := h.execute(ctx, dagRunCtx)
+	var ive messages.InvokeResponse_Error
+	if ref.DAGRunID == "" && errors.As(execErr, &ive) && ive.Type == "LambDAG.Retryable" {
+		// the retry of the first invocation would resend the DAG run config and start another DAG run,
+		// so the first invocation continues the DAG run with the reference instead.
+		dagRunCtx.Continue = true
+		execErr = nil
+	}
+	dagRunCtx.RetryReferenceVersion = nil
+	if execErr != nil {
+		dagRunCtx.RetryReferenceVersion = &ref.Version
+	}
+	newVersion, err := store.SaveDAGRunContext(ctx, dagRunCtx, version)
+	if err != nil {
+		h.dag.discardCallbacks(dagRunCtx)
+		var ce *DAGRunStateConflictError
+		if errors.As(err, &ce) {
 			return nil, messages.InvokeResponse_Error{
-				Message: tre.Error(),
-				Type:    "LambDAG.Retryable",
+				Message: ce.Error(),
+				Type:    "LambDAG.StateConflict",
 			}
 		}
-		var jme *json.MarshalerError
-		if errors.As(err, &jme) {
+		return nil, err
+	}
+	h.dag.invokeCallbacks(ctx, dagRunCtx)
+	if execErr != nil {
+		return nil, execErr
+	}
+	return &DAGRunReference{
+		DAGRunID:       dagRunCtx.DAGRunID,
+		Version:        newVersion,
+		Continue:       dagRunCtx.Continue,
+		IsCircuitBreak: dagRunCtx.IsCircuitBreak,
+	}, nil
+}
+
+func (h *LambdaHandler) execute(ctx context.Context, dagRunCtx *DAGRunContext) (updatedDAGRunCtx *DAGRunContext, err error) {
+	ctx, span := h.dag.startInvokeSpan(ctx, dagRunCtx)
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("lambdag.lambda_call_count", dagRunCtx.LambdaCallCount),
+			attribute.Bool("lambdag.continue", dagRunCtx.Continue),
+		)
+		endSpan(span, err)
+	}()
+	updatedDAGRunCtx, err = h.dag.executeWithSpan(ctx, dagRunCtx)
+	if err != nil {
+		var mte *MultiTaskError
+		if errors.As(err, &mte) {
+			return h.handleTaskErrors(updatedDAGRunCtx, mte)
+		}
+		var dce *DAGDefinitionChangedError
+		if errors.As(err, &dce) {
 			return nil, messages.InvokeResponse_Error{
-				Message: err.Error(),
-				Type:    "LambDAG.ResponseInvalid",
+				Message: dce.Error(),
+				Type:    "LambDAG.DAGDefinitionChanged",
 			}
 		}
 		return nil, err
 	}
 	if updatedDAGRunCtx.IsCircuitBreak {
-		return dagRunCtx, messages.InvokeResponse_Error{
+		return updatedDAGRunCtx, messages.InvokeResponse_Error{
 			Message: fmt.Sprintf("CircuitBreak: lambda call count over %d", h.dag.CircuitBreaker()),
 			Type:    "LambDAG.CircuitBreak",
 		}
 	}
 	return updatedDAGRunCtx, nil
 }
+
+func (h *LambdaHandler) handleTaskErrors(dagRunCtx *DAGRunContext, mte *MultiTaskError) (*DAGRunContext, error) {
+	if mte.IsRetryable() {
+		if h.dag.NumOfTasksInSingleInvoke() > 1 {
+			dagRunCtx.Continue = true
+			return dagRunCtx, nil
+		}
+		return nil, messages.InvokeResponse_Error{
+			Message: mte.Error(),
+			Type:    "LambDAG.Retryable",
+		}
+	}
+	if len(mte.Errors) > 1 {
+		return nil, messages.InvokeResponse_Error{
+			Message: mte.Error(),
+			Type:    "LambDAG.MultipleTasksFailed",
+		}
+	}
+	err := mte.Errors[0].Unwrap()
+	var jme *json.MarshalerError
+	if errors.As(err, &jme) {
+		return nil, messages.InvokeResponse_Error{
+			Message: err.Error(),
+			Type:    "LambDAG.ResponseInvalid",
+		}
+	}
+	return nil, err
+}
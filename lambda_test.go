@@ -3,11 +3,14 @@ package lambdag_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/Songmu/flextime"
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/mashiike/lambdag"
 	"github.com/stretchr/testify/require"
 )
@@ -88,18 +91,120 @@ func TestLambdaHandlerSimpleDAG(t *testing.T) {
 	}
 	require.ElementsMatch(t, []string{"task1", "task2", "task3", "task4"}, handleTasks)
 	require.EqualValues(t, fixedTime.Format(time.RFC3339), dagRunCtx.DAGRunStartAt.Format(time.RFC3339))
+	require.Len(t, dagRunCtx.TaskInstances, 4)
+	lambdaCallCounts := map[string]int{"task1": 1, "task2": 2, "task3": 2, "task4": 3}
+	for _, ti := range dagRunCtx.TaskInstances {
+		require.EqualValues(t, lambdaCallCounts[ti.TaskID], ti.LambdaCallCount)
+		require.EqualValues(t, 1, ti.Attempt)
+		require.EqualValues(t, "success", ti.Outcome)
+		require.False(t, ti.EndAt.Before(ti.StartAt))
+	}
 	expectedDAGRunCtx := lambdag.DAGRunContext{
-		DAGRunID:      dagRunID,
-		DAGRunConfig:  dagRunConfig,
-		DAGRunStartAt: dagRunCtx.DAGRunStartAt,
+		SchemaVersion:  lambdag.DAGRunContextSchemaVersion,
+		DAGRunID:       dagRunID,
+		DAGRunConfig:   dagRunConfig,
+		DAGRunStartAt:  dagRunCtx.DAGRunStartAt,
+		DAGFingerprint: dag.Fingerprint(),
 		TaskResponses: map[string]json.RawMessage{
 			"task1": json.RawMessage(`"task1 success"`),
 			"task2": json.RawMessage(`"task2 success"`),
 			"task3": json.RawMessage(`"task3 success"`),
 			"task4": json.RawMessage(`"task4 success"`),
 		},
+		TaskAttempts: map[string]int{
+			"task1": 1,
+			"task2": 1,
+			"task3": 1,
+			"task4": 1,
+		},
+		TaskInstances:   dagRunCtx.TaskInstances,
 		LambdaCallCount: 3,
 		Continue:        false,
 	}
 	require.EqualValues(t, expectedDAGRunCtx, dagRunCtx)
 }
+
+func TestLambdaHandlerMultipleTasksFailed(t *testing.T) {
+	dag, err := lambdag.NewDAG(
+		"FailedDAG",
+		lambdag.WithNumOfTasksInSingleInvoke(2),
+	)
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return nil, errors.New("task1 error")
+	}))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return nil, errors.New("task2 error")
+	}))
+	require.NoError(t, err)
+
+	handler := lambdag.NewLambdaHandler(dag)
+	_, err = handler.Invoke(context.Background(), []byte(`{}`))
+	var ive messages.InvokeResponse_Error
+	require.True(t, errors.As(err, &ive))
+	require.EqualValues(t, "LambDAG.MultipleTasksFailed", ive.Type)
+	require.EqualValues(t, "2 tasks failed: task `task1` failed: task1 error; task `task2` failed: task2 error", ive.Message)
+}
+
+func TestLambdaHandlerTaskRequest(t *testing.T) {
+	dag, err := lambdag.NewDAG(
+		"TaskRequestDAG",
+		lambdag.WithNumOfTasksInSingleInvoke(2),
+	)
+	require.NoError(t, err)
+	fixedTime := time.Date(2022, 06, 19, 9, 00, 00, 0, time.UTC)
+	restore := flextime.Set(fixedTime)
+	defer restore()
+
+	var requests []*lambdag.TaskRequest
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		requests = append(requests, tr)
+		taskID, ok := lambdag.TaskIDFromContext(ctx)
+		require.True(t, ok)
+		require.EqualValues(t, "task1", taskID)
+		dagRunID, ok := lambdag.DAGRunIDFromContext(ctx)
+		require.True(t, ok)
+		require.EqualValues(t, tr.DAGRunID, dagRunID)
+		attempt, ok := lambdag.TaskAttemptFromContext(ctx)
+		require.True(t, ok)
+		require.EqualValues(t, tr.Attempt, attempt)
+		if tr.Attempt < 2 {
+			return nil, lambdag.WrapTaskRetryable(errors.New("try again"))
+		}
+		return "task1 success", nil
+	}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithDeadline(context.Background(), fixedTime.Add(time.Minute))
+	defer cancel()
+	ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{
+		AwsRequestID: "request-id",
+	})
+	handler := lambdag.NewLambdaHandler(dag)
+	var dagRunCtx lambdag.DAGRunContext
+	payload := []byte(`{}`)
+	for i := 0; i < 3; i++ {
+		resp, err := handler.Invoke(ctx, payload)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(resp, &dagRunCtx))
+		if !dagRunCtx.Continue {
+			break
+		}
+		payload = resp
+	}
+	require.EqualValues(t, map[string]int{"task1": 2}, dagRunCtx.TaskAttempts)
+	require.Len(t, requests, 2)
+	for i, tr := range requests {
+		require.EqualValues(t, "task1", tr.TaskID)
+		require.EqualValues(t, i+1, tr.Attempt)
+		require.WithinDuration(t, fixedTime, tr.DAGRunStartAt, time.Second)
+		require.EqualValues(t, "request-id", tr.LambdaContext.AwsRequestID)
+		remaining, ok := tr.RemainingTime()
+		require.True(t, ok)
+		require.InDelta(t, time.Minute, remaining, float64(time.Second))
+	}
+
+	_, ok := lambdag.TaskIDFromContext(context.Background())
+	require.False(t, ok)
+}
@@ -0,0 +1,196 @@
+package lambdag
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// LogLevelEnvName is the environment variable name of the log level (debug, info, warn or error) of the default logger.
+const LogLevelEnvName = "LAMBDAG_LOG_LEVEL"
+
+// WithDAGSlogger sets the factory of the structured logger used by the DAG and the tasks.
+// dag_id, dag_run_id and lambda_call_count attributes are attached to the logger.
+func WithDAGSlogger(fn func(context.Context, *DAGRunContext) (*slog.Logger, error)) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		opts.newSloggerFunc = fn
+		return nil
+	}
+}
+
+// WithTaskSlogger sets the factory of the structured logger used by the task.
+// task_id and attempt attributes are attached to the logger, in addition to the DAG attributes.
+func WithTaskSlogger(fn func(context.Context, *DAGRunContext) (*slog.Logger, error)) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		opts.newSloggerFunc = fn
+		return nil
+	}
+}
+
+// NewSlogger returns the structured logger of the DAG run.
+// The logger of WithDAGSlogger is preferred, the *log.Logger of WithDAGLogger is bridged by LogLoggerHandler.
+// By default, JSON lines are written to stderr in AWS Lambda, and log.Default() is used in other environment.
+func (dag *DAG) NewSlogger(ctx context.Context, dagRunCtx *DAGRunContext) (*slog.Logger, error) {
+	l, _, err := dag.newLoggers(ctx, dagRunCtx)
+	if err != nil {
+		return nil, err
+	}
+	return l.With(dag.slogAttrs(dagRunCtx)...), nil
+}
+
+// newLoggers returns the structured logger without attributes, and the *log.Logger created by the factory if configured.
+func (dag *DAG) newLoggers(ctx context.Context, dagRunCtx *DAGRunContext) (*slog.Logger, *log.Logger, error) {
+	switch {
+	case dag.opts.newSloggerFunc != nil:
+		l, err := dag.opts.newSloggerFunc(ctx, dagRunCtx)
+		return l, nil, err
+	case dag.opts.newLoggerFunc != nil:
+		l, err := dag.opts.newLoggerFunc(ctx, dagRunCtx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return slog.New(NewLogLoggerHandler(l, logLevelFromEnv())), l, nil
+	case isLambda():
+		return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevelFromEnv()})), nil, nil
+	default:
+		return slog.New(NewLogLoggerHandler(log.Default(), logLevelFromEnv())), log.Default(), nil
+	}
+}
+
+func (dag *DAG) slogAttrs(dagRunCtx *DAGRunContext) []any {
+	return []any{
+		slog.String("dag_id", dag.ID()),
+		slog.String("dag_run_id", dagRunCtx.DAGRunID),
+		slog.Int("lambda_call_count", dagRunCtx.LambdaCallCount),
+	}
+}
+
+// NewSlogger returns the structured logger of the task.
+// The logger of WithTaskSlogger is preferred, then the *log.Logger of WithTaskLogger, then the logger of the DAG.
+func (task *Task) NewSlogger(ctx context.Context, dagRunCtx *DAGRunContext) (*slog.Logger, error) {
+	l, _, err := task.newLoggers(ctx, dagRunCtx)
+	return l, err
+}
+
+// newLoggers returns the structured logger with the task attributes, and *log.Logger for TaskRequest.Logger.
+// The *log.Logger created by the factory is used as it is, otherwise it writes to the structured logger.
+func (task *Task) newLoggers(ctx context.Context, dagRunCtx *DAGRunContext) (*slog.Logger, *log.Logger, error) {
+	var l *slog.Logger
+	var ll *log.Logger
+	var err error
+	switch {
+	case task.opts.newSloggerFunc != nil:
+		l, err = task.opts.newSloggerFunc(ctx, dagRunCtx)
+	case task.opts.newLoggerFunc != nil:
+		ll, err = task.opts.newLoggerFunc(ctx, dagRunCtx)
+		if err == nil {
+			l = slog.New(NewLogLoggerHandler(ll, logLevelFromEnv()))
+		}
+	default:
+		l, ll, err = task.dag.newLoggers(ctx, dagRunCtx)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	attrs := append(task.dag.slogAttrs(dagRunCtx),
+		slog.String("task_id", task.ID()),
+		slog.Int("attempt", dagRunCtx.TaskAttempts[task.ID()]),
+	)
+	if owner := task.Owner(); owner != "" {
+		attrs = append(attrs, slog.String("task_owner", owner))
+	}
+	if tags := task.Tags(); len(tags) > 0 {
+		attrs = append(attrs, slog.Any("task_tags", tags))
+	}
+	l = l.With(attrs...)
+	if ll == nil {
+		ll = slog.NewLogLogger(l.Handler(), slog.LevelInfo)
+	}
+	return l, ll, nil
+}
+
+func logLevelFromEnv() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv(LogLevelEnvName))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// LogLoggerHandler is the slog.Handler that writes records to *log.Logger as the line like `[info] message: key=value`,
+// for compatibility with the *log.Logger factories of WithDAGLogger and WithTaskLogger.
+type LogLoggerHandler struct {
+	l      *log.Logger
+	level  slog.Leveler
+	attrs  string
+	prefix string
+}
+
+func NewLogLoggerHandler(l *log.Logger, level slog.Leveler) *LogLoggerHandler {
+	return &LogLoggerHandler{
+		l:     l,
+		level: level,
+	}
+}
+
+func (h *LogLoggerHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *LogLoggerHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s", strings.ToLower(r.Level.String()), r.Message)
+	attrs := h.attrs
+	r.Attrs(func(attr slog.Attr) bool {
+		attrs += formatSlogAttr(h.prefix, attr)
+		return true
+	})
+	if attrs != "" {
+		b.WriteString(":")
+		b.WriteString(attrs)
+	}
+	return h.l.Output(2, b.String())
+}
+
+func (h *LogLoggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	cloned := *h
+	for _, attr := range attrs {
+		cloned.attrs += formatSlogAttr(h.prefix, attr)
+	}
+	return &cloned
+}
+
+func (h *LogLoggerHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	cloned := *h
+	cloned.prefix += name + "."
+	return &cloned
+}
+
+func formatSlogAttr(prefix string, attr slog.Attr) string {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return ""
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+		var s string
+		for _, ga := range attr.Value.Group() {
+			s += formatSlogAttr(groupPrefix, ga)
+		}
+		return s
+	}
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"\n") {
+		value = fmt.Sprintf("%q", value)
+	}
+	return fmt.Sprintf(" %s%s=%s", prefix, attr.Key, value)
+}
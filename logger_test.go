@@ -0,0 +1,102 @@
+package lambdag_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAGSlogger(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	handler := slog.NewJSONHandler(&syncWriter{w: &buf, mu: &mu}, nil)
+	dag, err := lambdag.NewDAG("test", lambdag.WithDAGSlogger(func(ctx context.Context, drc *lambdag.DAGRunContext) (*slog.Logger, error) {
+		return slog.New(handler), nil
+	}))
+	require.NoError(t, err)
+	task, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		tr.Slogger.Info("hello", "key", "value")
+		tr.Logger.Printf("legacy")
+		return "task1 success", nil
+	}))
+	require.NoError(t, err)
+
+	dagRunCtx, err := dag.Execute(context.Background(), &lambdag.DAGRunContext{
+		DAGRunID: "test-run",
+	})
+	require.NoError(t, err)
+	dagLogger, err := dag.NewLogger(context.Background(), dagRunCtx)
+	require.NoError(t, err)
+	dagLogger.Printf("dag legacy")
+	taskLogger, err := task.NewLogger(context.Background(), dagRunCtx)
+	require.NoError(t, err)
+	taskLogger.Printf("task legacy")
+
+	records := make(map[string]map[string]interface{})
+	mu.Lock()
+	defer mu.Unlock()
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		delete(record, "time")
+		records[record["msg"].(string)] = record
+	}
+	require.EqualValues(t, map[string]interface{}{
+		"level":             "INFO",
+		"msg":               "hello",
+		"dag_id":            "test",
+		"dag_run_id":        "test-run",
+		"lambda_call_count": float64(1),
+		"task_id":           "task1",
+		"attempt":           float64(1),
+		"key":               "value",
+	}, records["hello"])
+	require.EqualValues(t, "task1", records["legacy"]["task_id"])
+	require.EqualValues(t, "test-run", records["dag legacy"]["dag_run_id"])
+	require.EqualValues(t, "task1", records["task legacy"]["task_id"])
+	require.EqualValues(t, map[string]interface{}{
+		"level":             "INFO",
+		"msg":               "end task",
+		"dag_id":            "test",
+		"dag_run_id":        "test-run",
+		"lambda_call_count": float64(1),
+		"task_id":           "task1",
+		"attempt":           float64(1),
+		"success":           true,
+	}, records["end task"])
+}
+
+func TestDAGLoggerBridge(t *testing.T) {
+	t.Setenv(lambdag.LogLevelEnvName, "warn")
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	logger := log.New(&syncWriter{w: &buf, mu: &mu}, "", 0)
+	dag, err := lambdag.NewDAG("test", lambdag.WithDAGLogger(func(ctx context.Context, drc *lambdag.DAGRunContext) (*log.Logger, error) {
+		return logger, nil
+	}))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		require.Same(t, logger, tr.Logger)
+		tr.Slogger.Info("filtered")
+		tr.Slogger.WithGroup("g").Warn("something wrong", "key", "two words")
+		return "task1 success", nil
+	}))
+	require.NoError(t, err)
+
+	_, err = dag.Execute(context.Background(), &lambdag.DAGRunContext{
+		DAGRunID: "test-run",
+	})
+	require.NoError(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	require.EqualValues(t, "[warn] something wrong: dag_id=test dag_run_id=test-run lambda_call_count=1 task_id=task1 attempt=1 g.key=\"two words\"\n", buf.String())
+}
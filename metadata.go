@@ -0,0 +1,113 @@
+package lambdag
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// TaskLink is the link to the resource related to the task, for example the dashboard or the runbook.
+type TaskLink struct {
+	Title string `json:"Title"`
+	URL   string `json:"URL"`
+}
+
+func WithTaskDescription(description string) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		opts.description = description
+		return nil
+	}
+}
+
+func WithTaskOwner(owner string) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		opts.owner = owner
+		return nil
+	}
+}
+
+// WithTaskTags adds the tags of the task.
+func WithTaskTags(tags ...string) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		for _, tag := range tags {
+			if tag == "" {
+				return errors.New("task tag is empty")
+			}
+		}
+		opts.tags = lo.Uniq(append(opts.tags, tags...))
+		return nil
+	}
+}
+
+// WithTaskDocs sets the documentation of the task in Markdown.
+func WithTaskDocs(markdown string) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		opts.docs = markdown
+		return nil
+	}
+}
+
+// WithTaskLink adds the link of the task.
+func WithTaskLink(title string, url string) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		if url == "" {
+			return errors.New("task link url is empty")
+		}
+		opts.links = append(opts.links, TaskLink{Title: title, URL: url})
+		return nil
+	}
+}
+
+func (task *Task) Description() string {
+	return task.opts.description
+}
+
+func (task *Task) Owner() string {
+	return task.opts.owner
+}
+
+func (task *Task) Tags() []string {
+	return append([]string(nil), task.opts.tags...)
+}
+
+// HasTag returns true if the task has any of the tags.
+func (task *Task) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		if lo.Contains(task.opts.tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Docs returns the documentation of the task in Markdown.
+func (task *Task) Docs() string {
+	return task.opts.docs
+}
+
+func (task *Task) Links() []TaskLink {
+	return append([]TaskLink(nil), task.opts.links...)
+}
+
+// GetTasksByTag returns the tasks which have any of the tags.
+func (dag *DAG) GetTasksByTag(tags ...string) []*Task {
+	return lo.Filter(dag.GetAllTasks(), func(task *Task, _ int) bool {
+		return task.HasTag(tags...)
+	})
+}
+
+// metadataSummary returns the one line per item summary of the description, owner and tags, used as tooltips.
+func (task *Task) metadataSummary() string {
+	lines := make([]string, 0, 3)
+	if task.opts.description != "" {
+		lines = append(lines, task.opts.description)
+	}
+	if task.opts.owner != "" {
+		lines = append(lines, "owner: "+task.opts.owner)
+	}
+	if len(task.opts.tags) > 0 {
+		lines = append(lines, "tags: "+strings.Join(task.opts.tags, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,139 @@
+package lambdag_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	logHandler := slog.NewTextHandler(&syncWriter{w: &buf, mu: &mu}, nil)
+	dag, err := lambdag.NewDAG("MetadataDAG", lambdag.WithDAGSlogger(func(ctx context.Context, drc *lambdag.DAGRunContext) (*slog.Logger, error) {
+		return slog.New(logHandler), nil
+	}))
+	require.NoError(t, err)
+	handler := lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		tr.Slogger.Info("hello")
+		return nil, nil
+	})
+	extract, err := dag.NewTask("extract", handler,
+		lambdag.WithTaskDescription(`Extract "raw" events`),
+		lambdag.WithTaskOwner("data-team"),
+		lambdag.WithTaskTags("etl", "daily", "etl"),
+		lambdag.WithTaskDocs("# Extract\nReads the events."),
+		lambdag.WithTaskLink("runbook", "https://example.com/runbook"),
+	)
+	require.NoError(t, err)
+	load, err := dag.NewTask("load", handler, lambdag.WithTaskTags("etl"))
+	require.NoError(t, err)
+	report, err := dag.NewTask("report", handler, lambdag.WithTaskTags("report"))
+	require.NoError(t, err)
+	require.NoError(t, extract.SetDownstream(load))
+	require.NoError(t, load.SetDownstream(report))
+
+	got, ok := dag.GetTask("extract")
+	require.True(t, ok)
+	require.Same(t, extract, got)
+	require.EqualValues(t, `Extract "raw" events`, extract.Description())
+	require.EqualValues(t, "data-team", extract.Owner())
+	require.EqualValues(t, []string{"etl", "daily"}, extract.Tags())
+	require.EqualValues(t, "# Extract\nReads the events.", extract.Docs())
+	require.EqualValues(t, []lambdag.TaskLink{{Title: "runbook", URL: "https://example.com/runbook"}}, extract.Links())
+	require.True(t, extract.HasTag("report", "daily"))
+	require.False(t, extract.HasTag("report"))
+
+	tasks := dag.GetTasksByTag("etl")
+	require.Len(t, tasks, 2)
+	require.EqualValues(t, "extract", tasks[0].ID())
+	require.EqualValues(t, "load", tasks[1].ID())
+
+	_, err = dag.NewTask("invalid", nil, lambdag.WithTaskTags(""))
+	require.Error(t, err)
+	_, err = dag.NewTask("invalid", nil, lambdag.WithTaskLink("empty", ""))
+	require.Error(t, err)
+
+	var builder strings.Builder
+	require.NoError(t, dag.Render(&builder, "mermaid", lambdag.RenderOptions{}))
+	expected := `graph LR
+    extract("extract<br/>Extract #quot;raw#quot; events")
+    load("load")
+    report("report")
+    click extract href "https://example.com/runbook" "Extract #quot;raw#quot; events / owner: data-team / tags: etl, daily"
+
+    extract-->load
+    load-->report
+`
+	require.EqualValues(t, expected, builder.String())
+
+	builder.Reset()
+	require.NoError(t, dag.Render(&builder, "dot", lambdag.RenderOptions{}))
+	require.Contains(t, builder.String(), `tooltip="Extract \"raw\" events\nowner: data-team\ntags: etl, daily"`)
+	require.Contains(t, builder.String(), `URL="https://example.com/runbook"`)
+
+	builder.Reset()
+	require.NoError(t, dag.Render(&builder, "json", lambdag.RenderOptions{Tags: []string{"etl"}}))
+	expected = `{
+  "DAGId": "MetadataDAG",
+  "Nodes": [
+    {
+      "TaskId": "extract",
+      "Description": "Extract \"raw\" events",
+      "Owner": "data-team",
+      "Tags": [
+        "etl",
+        "daily"
+      ],
+      "Docs": "# Extract\nReads the events.",
+      "Links": [
+        {
+          "Title": "runbook",
+          "URL": "https://example.com/runbook"
+        }
+      ]
+    },
+    {
+      "TaskId": "load",
+      "Tags": [
+        "etl"
+      ]
+    }
+  ],
+  "Edges": [
+    {
+      "From": "extract",
+      "To": "load"
+    }
+  ]
+}
+`
+	require.EqualValues(t, expected, builder.String())
+
+	builder.Reset()
+	require.NoError(t, dag.Render(&builder, "ascii", lambdag.RenderOptions{Tags: []string{"report"}}))
+	require.EqualValues(t, "MetadataDAG\n[report]\n", builder.String())
+
+	// load is filtered out, extract is connected to report through load.
+	stdout := captureStdout(t, func() {
+		require.NoError(t, lambdag.Run([]string{"render", "-format", "d2", "-tags", " daily , report "}, dag))
+	})
+	expected = `direction: right
+"extract": {tooltip: "Extract \"raw\" events\nowner: data-team\ntags: etl, daily"; link: "https://example.com/runbook"}
+"report": {tooltip: "tags: report"}
+"extract" -> "report"
+`
+	require.EqualValues(t, expected, stdout)
+
+	_, err = dag.Execute(context.Background(), &lambdag.DAGRunContext{DAGRunID: "test-run"})
+	require.NoError(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Contains(t, buf.String(), `msg=hello dag_id=MetadataDAG dag_run_id=test-run lambda_call_count=1 task_id=extract attempt=1 task_owner=data-team task_tags="[etl daily]"`)
+}
@@ -0,0 +1,263 @@
+package lambdag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// Metric is the data point emitted by DAG.Execute and Task.Execute.
+//
+// Task metrics: TaskDuration (Milliseconds) and TaskExecutions (Count) with DAGId, TaskId and Outcome (success, retry or failure) dimensions.
+// DAG run metrics: DAGRunDuration (Milliseconds) and DAGRunInvocations (Count) with DAGId and Outcome (success, failure or circuit_break) dimensions,
+// emitted by the invocation that ends the DAG run.
+type Metric struct {
+	Name       string            `json:"Name"`
+	Unit       string            `json:"Unit"`
+	Value      float64           `json:"Value"`
+	Dimensions map[string]string `json:"Dimensions"`
+	Timestamp  time.Time         `json:"Timestamp"`
+}
+
+const (
+	MetricUnitMilliseconds = "Milliseconds"
+	MetricUnitCount        = "Count"
+)
+
+// MetricsSink receives the metrics.
+type MetricsSink interface {
+	PutMetrics(ctx context.Context, metrics []Metric) error
+}
+
+func WithMetricsSink(sink MetricsSink) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		if sink == nil {
+			return errors.New("metrics sink is nil")
+		}
+		opts.metricsSink = sink
+		return nil
+	}
+}
+
+func (dag *DAG) MetricsSink() MetricsSink {
+	return dag.opts.metricsSink
+}
+
+type metricsSinkContextKey struct{}
+
+// withMetricsSink returns the context with the sink which receives the metrics in addition to the sink of the DAG.
+func withMetricsSink(ctx context.Context, sink MetricsSink) context.Context {
+	return context.WithValue(ctx, metricsSinkContextKey{}, sink)
+}
+
+// newMetricsSinkHandler wraps the Lambda handler, so that the metrics of the invocations are also put to the sink.
+func newMetricsSinkHandler(handler lambda.Handler, sink MetricsSink) lambda.Handler {
+	return metricsSinkHandler{handler: handler, sink: sink}
+}
+
+type metricsSinkHandler struct {
+	handler lambda.Handler
+	sink    MetricsSink
+}
+
+func (h metricsSinkHandler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	return h.handler.Invoke(withMetricsSink(ctx, h.sink), payload)
+}
+
+func (dag *DAG) metricsSink(ctx context.Context) MetricsSink {
+	sink, ok := ctx.Value(metricsSinkContextKey{}).(MetricsSink)
+	switch {
+	case !ok:
+		return dag.opts.metricsSink
+	case dag.opts.metricsSink == nil:
+		return sink
+	default:
+		return multiMetricsSink{dag.opts.metricsSink, sink}
+	}
+}
+
+func (dag *DAG) putMetrics(ctx context.Context, dagRunCtx *DAGRunContext, metrics ...Metric) {
+	sink := dag.metricsSink(ctx)
+	if sink == nil {
+		return
+	}
+	if err := sink.PutMetrics(ctx, metrics); err != nil {
+		if l, lerr := dag.NewSlogger(ctx, dagRunCtx); lerr == nil {
+			l.Warn("put metrics", "error", err)
+		}
+	}
+}
+
+func (task *Task) putMetrics(ctx context.Context, dagRunCtx *DAGRunContext, start time.Time, err error) {
+	dimensions := map[string]string{
+		"DAGId":   task.dag.ID(),
+		"TaskId":  task.ID(),
+		"Outcome": taskOutcome(err),
+	}
+	now := flextime.Now()
+	task.dag.putMetrics(ctx, dagRunCtx, Metric{
+		Name:       "TaskDuration",
+		Unit:       MetricUnitMilliseconds,
+		Value:      float64(now.Sub(start)) / float64(time.Millisecond),
+		Dimensions: dimensions,
+		Timestamp:  now,
+	}, Metric{
+		Name:       "TaskExecutions",
+		Unit:       MetricUnitCount,
+		Value:      1,
+		Dimensions: dimensions,
+		Timestamp:  now,
+	})
+}
+
+// taskOutcome classifies the result of the task execution into success, retry or failure.
+func taskOutcome(err error) string {
+	if err == nil {
+		return "success"
+	}
+	var tre *TaskRetryableError
+	if errors.As(err, &tre) {
+		return "retry"
+	}
+	return "failure"
+}
+
+func (dag *DAG) putDAGRunMetrics(ctx context.Context, dagRunCtx *DAGRunContext, outcome string) {
+	dimensions := map[string]string{
+		"DAGId":   dag.ID(),
+		"Outcome": outcome,
+	}
+	now := flextime.Now()
+	dag.putMetrics(ctx, dagRunCtx, Metric{
+		Name:       "DAGRunDuration",
+		Unit:       MetricUnitMilliseconds,
+		Value:      float64(now.Sub(dagRunCtx.DAGRunStartAt)) / float64(time.Millisecond),
+		Dimensions: dimensions,
+		Timestamp:  now,
+	}, Metric{
+		Name:       "DAGRunInvocations",
+		Unit:       MetricUnitCount,
+		Value:      float64(dagRunCtx.LambdaCallCount),
+		Dimensions: dimensions,
+		Timestamp:  now,
+	})
+}
+
+// EMFMetricsSink writes the metrics as CloudWatch Embedded Metric Format JSON lines.
+// In AWS Lambda, the lines written to stdout are extracted as CloudWatch metrics without agent.
+type EMFMetricsSink struct {
+	mu        sync.Mutex
+	w         io.Writer
+	namespace string
+}
+
+// NewEMFMetricsSink returns EMFMetricsSink, w is os.Stdout if nil.
+func NewEMFMetricsSink(w io.Writer, namespace string) *EMFMetricsSink {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &EMFMetricsSink{
+		w:         w,
+		namespace: namespace,
+	}
+}
+
+type emfMetricDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+func (sink *EMFMetricsSink) PutMetrics(_ context.Context, metrics []Metric) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	for _, metric := range metrics {
+		dimensionKeys := make([]string, 0, len(metric.Dimensions))
+		line := make(map[string]interface{}, len(metric.Dimensions)+2)
+		for key, value := range metric.Dimensions {
+			dimensionKeys = append(dimensionKeys, key)
+			line[key] = value
+		}
+		sort.Strings(dimensionKeys)
+		line["_aws"] = map[string]interface{}{
+			"Timestamp": metric.Timestamp.UnixMilli(),
+			"CloudWatchMetrics": []emfMetricDirective{
+				{
+					Namespace:  sink.namespace,
+					Dimensions: [][]string{dimensionKeys},
+					Metrics:    []emfMetricDefinition{{Name: metric.Name, Unit: metric.Unit}},
+				},
+			},
+		}
+		line[metric.Name] = metric.Value
+		bs, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		if _, err := sink.w.Write(append(bs, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InMemoryMetricsSink keeps the metrics in memory, for testing and local development.
+type InMemoryMetricsSink struct {
+	mu      sync.Mutex
+	metrics []Metric
+}
+
+func NewInMemoryMetricsSink() *InMemoryMetricsSink {
+	return &InMemoryMetricsSink{}
+}
+
+func (sink *InMemoryMetricsSink) PutMetrics(_ context.Context, metrics []Metric) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.metrics = append(sink.metrics, metrics...)
+	return nil
+}
+
+// Metrics returns the copy of the metrics received so far.
+func (sink *InMemoryMetricsSink) Metrics() []Metric {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return append([]Metric{}, sink.metrics...)
+}
+
+// ServeHTTP writes the metrics as JSON.
+func (sink *InMemoryMetricsSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sink.Metrics())
+}
+
+type multiMetricsSink []MetricsSink
+
+func (sinks multiMetricsSink) PutMetrics(ctx context.Context, metrics []Metric) error {
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.PutMetrics(ctx, metrics); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
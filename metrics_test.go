@@ -0,0 +1,95 @@
+package lambdag_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsSink(t *testing.T) {
+	sink := lambdag.NewInMemoryMetricsSink()
+	dag, err := lambdag.NewDAG("MetricsDAG", lambdag.WithMetricsSink(sink), lambdag.WithNumOfTasksInSingleInvoke(2))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		if tr.Attempt < 2 {
+			return nil, lambdag.WrapTaskRetryable(errors.New("try again"))
+		}
+		return "task1 success", nil
+	}))
+	require.NoError(t, err)
+
+	handler := lambdag.NewLambdaHandler(dag)
+	dagRunCtx := invokeUntilEnd(t, handler, []byte(`{}`))
+	payload, err := json.Marshal(dagRunCtx)
+	require.NoError(t, err)
+	invokeUntilEnd(t, handler, payload)
+
+	type key struct {
+		Name    string
+		TaskID  string
+		Outcome string
+	}
+	counts := make(map[key]float64)
+	for _, metric := range sink.Metrics() {
+		if metric.Unit == lambdag.MetricUnitCount {
+			counts[key{metric.Name, metric.Dimensions["TaskId"], metric.Dimensions["Outcome"]}] += metric.Value
+		}
+		require.EqualValues(t, "MetricsDAG", metric.Dimensions["DAGId"])
+	}
+	require.EqualValues(t, map[key]float64{
+		{"TaskExecutions", "task1", "retry"}:   1,
+		{"TaskExecutions", "task1", "success"}: 1,
+		{"DAGRunInvocations", "", "success"}:   2,
+	}, counts)
+}
+
+func TestEMFMetricsSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := lambdag.NewEMFMetricsSink(&buf, "LambDAG")
+	err := sink.PutMetrics(context.Background(), []lambdag.Metric{
+		{
+			Name:       "TaskDuration",
+			Unit:       lambdag.MetricUnitMilliseconds,
+			Value:      12.5,
+			Dimensions: map[string]string{"DAGId": "SampleDAG", "TaskId": "task1", "Outcome": "success"},
+			Timestamp:  time.Date(2022, 06, 19, 9, 00, 00, 0, time.UTC),
+		},
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"_aws": {
+			"Timestamp": 1655629200000,
+			"CloudWatchMetrics": [{
+				"Namespace": "LambDAG",
+				"Dimensions": [["DAGId", "Outcome", "TaskId"]],
+				"Metrics": [{"Name": "TaskDuration", "Unit": "Milliseconds"}]
+			}]
+		},
+		"DAGId": "SampleDAG",
+		"TaskId": "task1",
+		"Outcome": "success",
+		"TaskDuration": 12.5
+	}`, buf.String())
+}
+
+func TestInMemoryMetricsSinkServeHTTP(t *testing.T) {
+	sink := lambdag.NewInMemoryMetricsSink()
+	require.NoError(t, sink.PutMetrics(context.Background(), []lambdag.Metric{
+		{Name: "TaskExecutions", Unit: lambdag.MetricUnitCount, Value: 1},
+	}))
+	w := httptest.NewRecorder()
+	sink.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lambdag/metrics", nil))
+	require.EqualValues(t, http.StatusOK, w.Code)
+	var metrics []lambdag.Metric
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metrics))
+	require.Len(t, metrics, 1)
+	require.EqualValues(t, "TaskExecutions", metrics[0].Name)
+}
@@ -0,0 +1,85 @@
+package lambdag
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/Songmu/flextime"
+)
+
+// TaskMiddleware wraps TaskHandler, to share the boilerplate among task handlers.
+type TaskMiddleware func(TaskHandler) TaskHandler
+
+// WithTaskMiddleware adds middlewares applied to all task handlers in the DAG.
+// DAG middlewares are applied outside of the task middlewares, the first middleware is the outermost.
+func WithTaskMiddleware(middlewares ...TaskMiddleware) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		for _, middleware := range middlewares {
+			if middleware == nil {
+				return errors.New("middleware is nil")
+			}
+		}
+		opts.middlewares = append(opts.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// WithMiddleware adds middlewares applied to the task handler, the first middleware is the outermost.
+func WithMiddleware(middlewares ...TaskMiddleware) func(opts *TaskOptions) error {
+	return func(opts *TaskOptions) error {
+		for _, middleware := range middlewares {
+			if middleware == nil {
+				return errors.New("middleware is nil")
+			}
+		}
+		opts.middlewares = append(opts.middlewares, middlewares...)
+		return nil
+	}
+}
+
+func applyTaskMiddlewares(handler TaskHandler, middlewares ...TaskMiddleware) TaskHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// TimingMiddleware logs the duration of the task handler.
+func TimingMiddleware() TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return TaskHandlerFunc(func(ctx context.Context, req *TaskRequest) (interface{}, error) {
+			start := flextime.Now()
+			resp, err := next.Invoke(ctx, req)
+			req.Slogger.Info("task handler duration", slog.Duration("duration", flextime.Since(start)), slog.Bool("success", err == nil))
+			return resp, err
+		})
+	}
+}
+
+// RecoverMiddleware converts the panic of the inner handler into TaskPanicError,
+// so that the outer middlewares can handle it as an error.
+func RecoverMiddleware() TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return TaskHandlerFunc(func(ctx context.Context, req *TaskRequest) (resp interface{}, err error) {
+			defer recoverTaskPanic(req, &resp, &err)
+			return next.Invoke(ctx, req)
+		})
+	}
+}
+
+func recoverTaskPanic(req *TaskRequest, resp *interface{}, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	stack := debug.Stack()
+	req.Slogger.Error("task panic", slog.Any("panic", v), slog.String("stack", string(stack)))
+	*resp = nil
+	*err = &TaskPanicError{
+		TaskID: req.TaskID,
+		Value:  v,
+		Stack:  stack,
+	}
+}
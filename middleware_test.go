@@ -0,0 +1,136 @@
+package lambdag_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskMiddlewareOrder(t *testing.T) {
+	var mu sync.Mutex
+	calls := make([]string, 0)
+	record := func(name string) lambdag.TaskMiddleware {
+		return func(next lambdag.TaskHandler) lambdag.TaskHandler {
+			return lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+				mu.Lock()
+				calls = append(calls, "before "+name)
+				mu.Unlock()
+				resp, err := next.Invoke(ctx, tr)
+				mu.Lock()
+				calls = append(calls, "after "+name)
+				mu.Unlock()
+				return resp, err
+			})
+		}
+	}
+	dag, err := lambdag.NewDAG("test", lambdag.WithTaskMiddleware(record("dag1"), record("dag2")))
+	require.NoError(t, err)
+	task, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, "handler")
+		return "task1 success", nil
+	}), lambdag.WithMiddleware(record("task1"), record("task2")))
+	require.NoError(t, err)
+
+	_, err = dag.Execute(context.Background(), &lambdag.DAGRunContext{
+		DAGRunID:      "test-run",
+		TaskResponses: map[string]json.RawMessage{},
+	})
+	require.NoError(t, err)
+	expected := []string{
+		"before dag1",
+		"before dag2",
+		"before task1",
+		"before task2",
+		"handler",
+		"after task2",
+		"after task1",
+		"after dag2",
+		"after dag1",
+	}
+	require.EqualValues(t, expected, calls)
+
+	calls = calls[:0]
+	_, err = task.TaskHandler().Invoke(context.Background(), &lambdag.TaskRequest{TaskID: "task1"})
+	require.NoError(t, err)
+	require.EqualValues(t, expected, calls, "TaskHandler returns the handler wrapped with the middlewares")
+}
+
+func TestBuiltinTaskMiddlewares(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	logger := log.New(&syncWriter{w: &buf, mu: &mu}, "", 0)
+	var panicErr error
+	catchPanic := func(next lambdag.TaskHandler) lambdag.TaskHandler {
+		return lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+			resp, err := next.Invoke(ctx, tr)
+			var tpe *lambdag.TaskPanicError
+			if errors.As(err, &tpe) {
+				panicErr = err
+			}
+			return resp, err
+		})
+	}
+	dag, err := lambdag.NewDAG(
+		"test",
+		lambdag.WithNumOfTasksInSingleInvoke(3),
+		lambdag.WithDAGLogger(func(ctx context.Context, drc *lambdag.DAGRunContext) (*log.Logger, error) {
+			return logger, nil
+		}),
+		lambdag.WithTaskMiddleware(lambdag.TimingMiddleware()),
+	)
+	require.NoError(t, err)
+	_, err = dag.NewTask("panic", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		panic("something wrong")
+	}), lambdag.WithMiddleware(catchPanic, lambdag.RecoverMiddleware()))
+	require.NoError(t, err)
+	_, err = dag.NewTask("large", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return strings.Repeat("x", 100), nil
+	}), lambdag.WithTaskResponseSizeLimit(50))
+	require.NoError(t, err)
+	_, err = dag.NewTask("small", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "small", nil
+	}), lambdag.WithTaskResponseSizeLimit(50))
+	require.NoError(t, err)
+
+	dagRunCtx, err := dag.Execute(context.Background(), &lambdag.DAGRunContext{
+		DAGRunID:      "test-run",
+		TaskResponses: map[string]json.RawMessage{},
+	})
+	var mte *lambdag.MultiTaskError
+	require.True(t, errors.As(err, &mte))
+	require.EqualValues(t, []string{"large", "panic"}, mte.TaskIDs())
+	var trtle *lambdag.TaskResponseTooLargeError
+	require.True(t, errors.As(mte.Errors[0], &trtle))
+	require.EqualValues(t, 102, trtle.Size)
+	require.Error(t, panicErr)
+	require.EqualValues(t, map[string]json.RawMessage{
+		"small": json.RawMessage(`"small"`),
+	}, dagRunCtx.TaskResponses)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, taskID := range []string{"panic", "large", "small"} {
+		require.Contains(t, buf.String(), "[info] task handler duration: dag_id=test dag_run_id=test-run lambda_call_count=1 task_id="+taskID+" attempt=1 duration=")
+	}
+}
+
+type syncWriter struct {
+	w  *bytes.Buffer
+	mu *sync.Mutex
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
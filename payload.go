@@ -0,0 +1,104 @@
+package lambdag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// StepFunctions limits the state payload to 256 KB.
+const defaultPayloadSizeLimit = 256 * 1024
+
+func WithPayloadSizeLimit(limitBytes int) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		opts.payloadSizeLimit = limitBytes
+		return nil
+	}
+}
+
+func WithPayloadSizeWarning(warningBytes int) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		opts.payloadSizeWarning = warningBytes
+		return nil
+	}
+}
+
+func (dag *DAG) PayloadSizeLimit() int {
+	if dag.opts.payloadSizeLimit <= 0 {
+		return defaultPayloadSizeLimit
+	}
+	return dag.opts.payloadSizeLimit
+}
+
+// PayloadSizeWarning returns the payload size to log a warning, default is 80% of PayloadSizeLimit.
+func (dag *DAG) PayloadSizeWarning() int {
+	if dag.opts.payloadSizeWarning <= 0 {
+		return dag.PayloadSizeLimit() * 8 / 10
+	}
+	return dag.opts.payloadSizeWarning
+}
+
+type TaskResponseSize struct {
+	TaskID string
+	Size   int
+}
+
+type PayloadTooLargeError struct {
+	Size                 int
+	Limit                int
+	LargestTaskResponses []TaskResponseSize
+}
+
+func (err *PayloadTooLargeError) Error() string {
+	largest := make([]string, 0, len(err.LargestTaskResponses))
+	for _, s := range err.LargestTaskResponses {
+		largest = append(largest, fmt.Sprintf("%s (%d bytes)", s.TaskID, s.Size))
+	}
+	return fmt.Sprintf("payload size %d bytes exceeds the limit %d bytes: largest task responses: %s", err.Size, err.Limit, strings.Join(largest, ", "))
+}
+
+const numOfLargestTaskResponses = 3
+
+func largestTaskResponses(dagRunCtx *DAGRunContext) []TaskResponseSize {
+	sizes := make([]TaskResponseSize, 0, len(dagRunCtx.TaskResponses))
+	for taskID, resp := range dagRunCtx.TaskResponses {
+		sizes = append(sizes, TaskResponseSize{TaskID: taskID, Size: len(resp)})
+	}
+	sort.SliceStable(sizes, func(i, j int) bool {
+		if sizes[i].Size == sizes[j].Size {
+			return sizes[i].TaskID < sizes[j].TaskID
+		}
+		return sizes[i].Size > sizes[j].Size
+	})
+	if len(sizes) > numOfLargestTaskResponses {
+		sizes = sizes[:numOfLargestTaskResponses]
+	}
+	return sizes
+}
+
+func (h *LambdaHandler) checkPayloadSize(ctx context.Context, dagRunCtx *DAGRunContext) error {
+	bs, err := json.Marshal(dagRunCtx)
+	if err != nil {
+		return err
+	}
+	size := len(bs)
+	if size < h.dag.PayloadSizeWarning() {
+		return nil
+	}
+	if size > h.dag.PayloadSizeLimit() {
+		return &PayloadTooLargeError{
+			Size:                 size,
+			Limit:                h.dag.PayloadSizeLimit(),
+			LargestTaskResponses: largestTaskResponses(dagRunCtx),
+		}
+	}
+	l, err := h.dag.NewSlogger(ctx, dagRunCtx)
+	if err != nil {
+		return err
+	}
+	l.Warn("payload size is approaching the limit", slog.Int("size", size), slog.Int("limit", h.dag.PayloadSizeLimit()))
+	return nil
+}
@@ -0,0 +1,143 @@
+package lambdag_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskResponseCompression(t *testing.T) {
+	dag, err := lambdag.NewDAG(
+		"CompressionDAG",
+		lambdag.WithTaskResponseCompression(true),
+	)
+	require.NoError(t, err)
+	largeResponse := map[string]string{"Message": strings.Repeat("abc", 1000)}
+	var received json.RawMessage
+	task1, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return largeResponse, nil
+	}))
+	require.NoError(t, err)
+	task2, err := dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		received = tr.TaskResponses["task1"]
+		return "ok", nil
+	}))
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2))
+
+	dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+	require.JSONEq(t, string(Must(json.Marshal(largeResponse))), string(received))
+	require.Contains(t, string(dagRunCtx.TaskResponses["task1"]), `"Compression":"gzip"`)
+	require.Less(t, len(dagRunCtx.TaskResponses["task1"]), 3000)
+	require.EqualValues(t, `"ok"`, string(dagRunCtx.TaskResponses["task2"]), "small response is not compressed")
+}
+
+func TestTaskResponseEnvelopeLookalike(t *testing.T) {
+	dag, err := lambdag.NewDAG("EnvelopeDAG")
+	require.NoError(t, err)
+	lookalike := `{"LambDAGEnvelope":{"Version":1,"Ref":"file:///etc/passwd"}}`
+	var received json.RawMessage
+	task1, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return json.RawMessage(lookalike), nil
+	}))
+	require.NoError(t, err)
+	task2, err := dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		received = tr.TaskResponses["task1"]
+		return "ok", nil
+	}))
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2))
+
+	dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+	require.JSONEq(t, lookalike, string(received), "the task response shaped like an envelope is passed through as it is")
+	require.JSONEq(t, `{"LambDAGEnvelope":{"Version":1,"Raw":`+lookalike+`}}`, string(dagRunCtx.TaskResponses["task1"]))
+}
+
+func TestTaskResponseEnvelopeInvalid(t *testing.T) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, err := w.Write([]byte(`{"LambDAGEnvelope":{"Version":1,"Ref":"file:///etc/passwd"}}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	cases := map[string]string{
+		"without version":     `{"LambDAGEnvelope":{"Raw":"data"}}`,
+		"unsupported version": `{"LambDAGEnvelope":{"Version":2,"Raw":"data"}}`,
+		"unknown field":       `{"LambDAGEnvelope":{"Version":1,"Raw":"data","Extra":true}}`,
+		"multiple layers":     `{"LambDAGEnvelope":{"Version":1,"Raw":"data","Compression":"gzip"}}`,
+		"unexpected order":    string(Must(json.Marshal(map[string]interface{}{"LambDAGEnvelope": map[string]interface{}{"Version": 1, "Compression": "gzip", "Data": compressed.Bytes()}}))),
+	}
+	for name, payload := range cases {
+		t.Run(name, func(t *testing.T) {
+			handled := make([]string, 0)
+			dag := newChainDAG(t, []string{"task1", "task2"}, &handled)
+			_, err := dag.Execute(context.Background(), &lambdag.DAGRunContext{
+				DAGRunID:      "test-run",
+				TaskResponses: map[string]json.RawMessage{"task1": json.RawMessage(payload)},
+			})
+			require.ErrorContains(t, err, "invalid task response envelope")
+			require.Empty(t, handled)
+		})
+	}
+}
+
+func TestPayloadSizeGuard(t *testing.T) {
+	var logBuf bytes.Buffer
+	dag, err := lambdag.NewDAG(
+		"PayloadSizeDAG",
+		lambdag.WithNumOfTasksInSingleInvoke(3),
+		lambdag.WithPayloadSizeLimit(2000),
+		lambdag.WithPayloadSizeWarning(1000),
+		lambdag.WithDAGLogger(func(_ context.Context, _ *lambdag.DAGRunContext) (*log.Logger, error) {
+			return log.New(&logBuf, "", 0), nil
+		}),
+	)
+	require.NoError(t, err)
+	for _, s := range []struct {
+		taskID string
+		size   int
+	}{
+		{"task1", 300},
+		{"task2", 900},
+		{"task3", 600},
+	} {
+		size := s.size
+		_, err := dag.NewTask(s.taskID, lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+			return strings.Repeat("x", size), nil
+		}))
+		require.NoError(t, err)
+	}
+	handler := lambdag.NewLambdaHandler(dag)
+	_, err = handler.Invoke(context.Background(), []byte(`{}`))
+	var ive messages.InvokeResponse_Error
+	require.True(t, errors.As(err, &ive))
+	require.EqualValues(t, "LambDAG.PayloadTooLarge", ive.Type)
+	require.Contains(t, ive.Message, "exceeds the limit 2000 bytes: largest task responses: task2 (902 bytes), task3 (602 bytes), task1 (302 bytes)")
+
+	logBuf.Reset()
+	dag, err = lambdag.NewDAG(
+		"PayloadSizeDAG",
+		lambdag.WithPayloadSizeLimit(2000),
+		lambdag.WithPayloadSizeWarning(1000),
+		lambdag.WithDAGLogger(func(_ context.Context, _ *lambdag.DAGRunContext) (*log.Logger, error) {
+			return log.New(&logBuf, "", 0), nil
+		}),
+	)
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return strings.Repeat("x", 1000), nil
+	}))
+	require.NoError(t, err)
+	handler = lambdag.NewLambdaHandler(dag)
+	_, err = handler.Invoke(context.Background(), []byte(`{}`))
+	require.NoError(t, err)
+	require.Contains(t, logBuf.String(), "[warn] payload size is approaching the limit")
+}
@@ -0,0 +1,400 @@
+package lambdag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/samber/lo"
+)
+
+// Renderer renders the DAG in some format.
+type Renderer interface {
+	Render(w io.Writer, dag *DAG, opts RenderOptions) error
+}
+
+type RendererFunc func(w io.Writer, dag *DAG, opts RenderOptions) error
+
+func (f RendererFunc) Render(w io.Writer, dag *DAG, opts RenderOptions) error {
+	return f(w, dag, opts)
+}
+
+type RenderOptions struct {
+	// TaskStates colors the tasks by the status in the DAG run, if not nil.
+	TaskStates map[string]TaskState
+	// DAGRunContext is the DAG run rendered by the gantt formats.
+	DAGRunContext *DAGRunContext
+	// Tags filters the rendered tasks to the tasks which have any of the tags, if not empty.
+	Tags []string
+}
+
+// Tasks returns the tasks to render.
+func (opts RenderOptions) Tasks(dag *DAG) []*Task {
+	if len(opts.Tags) == 0 {
+		return dag.GetAllTasks()
+	}
+	return dag.GetTasksByTag(opts.Tags...)
+}
+
+// WarkDependencies walks the dependencies between the tasks to render.
+// With Tags, the tasks are connected through the filtered out tasks, so that a task depends on its nearest ancestors to render.
+func (opts RenderOptions) WarkDependencies(dag *DAG, fn func(ancestor, descendant *Task) error) error {
+	if len(opts.Tags) == 0 {
+		return dag.WarkAllDependencies(fn)
+	}
+	for _, ancestor := range opts.Tasks(dag) {
+		for _, descendant := range opts.nearestDescendants(dag, ancestor) {
+			if err := fn(ancestor, descendant); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nearestDescendants returns the descendants to render, which are reached from the task only through the filtered out tasks.
+func (opts RenderOptions) nearestDescendants(dag *DAG, task *Task) []*Task {
+	nearest := make(map[string]bool)
+	visited := make(map[string]bool)
+	queue := dag.GetDownstreamTasks(task.ID())
+	for len(queue) > 0 {
+		descendant := queue[0]
+		queue = queue[1:]
+		if visited[descendant.ID()] {
+			continue
+		}
+		visited[descendant.ID()] = true
+		if opts.includes(descendant) {
+			nearest[descendant.ID()] = true
+			continue
+		}
+		queue = append(queue, dag.GetDownstreamTasks(descendant.ID())...)
+	}
+	return lo.Filter(dag.GetAllTasks(), func(task *Task, _ int) bool {
+		return nearest[task.ID()]
+	})
+}
+
+func (opts RenderOptions) includes(task *Task) bool {
+	return len(opts.Tags) == 0 || task.HasTag(opts.Tags...)
+}
+
+func (opts RenderOptions) filterTasks(tasks []*Task) []*Task {
+	return lo.Filter(tasks, func(task *Task, _ int) bool {
+		return opts.includes(task)
+	})
+}
+
+var (
+	renderersMu sync.RWMutex
+	renderers   = map[string]Renderer{
+		"markdown":   RendererFunc(renderMarkdown),
+		"mermaid":    RendererFunc(renderMermaid),
+		"dot":        RendererFunc(renderDOT),
+		"plantuml":   RendererFunc(renderPlantUML),
+		"d2":         RendererFunc(renderD2),
+		"json":       RendererFunc(renderJSON),
+		"ascii":      RendererFunc(renderASCII),
+		"gantt":      RendererFunc(renderGantt),
+		"gantt-html": RendererFunc(renderGanttHTML),
+		"html":       RendererFunc(renderHTML),
+	}
+)
+
+// RegisterRenderer registers the renderer of the format, the registered renderer is also available in the render command.
+// The renderer of the same format is replaced.
+func RegisterRenderer(format string, renderer Renderer) {
+	if renderer == nil {
+		panic("lambdag: RegisterRenderer renderer is nil")
+	}
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	renderers[format] = renderer
+}
+
+// UnregisterRenderer removes the renderer of the format, including the built-in formats.
+func UnregisterRenderer(format string) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	delete(renderers, format)
+}
+
+func GetRenderer(format string) (Renderer, bool) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	renderer, ok := renderers[format]
+	return renderer, ok
+}
+
+// RenderFormats returns the sorted list of the registered formats.
+func RenderFormats() []string {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	formats := make([]string, 0, len(renderers))
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Render renders the DAG by the renderer of the format.
+func (dag *DAG) Render(w io.Writer, format string, opts RenderOptions) error {
+	renderer, ok := GetRenderer(format)
+	if !ok {
+		return fmt.Errorf("unknown format `%s`", format)
+	}
+	return renderer.Render(w, dag, opts)
+}
+
+var renderTaskStates = []TaskState{TaskStateDone, TaskStatePending, TaskStateExecutable, TaskStateFailed, TaskStateSkipped}
+
+func renderID(id string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(id, " ", "_"), "-", "_")
+}
+
+func renderDOT(w io.Writer, dag *DAG, opts RenderOptions) error {
+	g := gographviz.NewGraph()
+	graphName := dag.ID()
+	edgeAttrs := make(map[string]string)
+	edgeAttrs["arrowhead"] = "vee"
+	if err := g.SetName(graphName); err != nil {
+		return err
+	}
+	if err := g.SetDir(true); err != nil {
+		return err
+	}
+	tasks := opts.Tasks(dag)
+	for _, task := range tasks {
+		nodeAttrs := map[string]string{
+			"shape": `"ellipse"`,
+			"style": `"filled"`,
+		}
+		if state, ok := opts.TaskStates[task.ID()]; ok {
+			nodeAttrs["fillcolor"] = fmt.Sprintf(`"%s"`, taskStateColors[state])
+		}
+		if summary := task.metadataSummary(); summary != "" {
+			nodeAttrs["tooltip"] = strconv.Quote(summary)
+		}
+		if links := task.Links(); len(links) > 0 {
+			nodeAttrs["URL"] = strconv.Quote(links[0].URL)
+		}
+		nodeName := task.ID()
+		if err := g.AddNode(graphName, nodeName, nodeAttrs); err != nil {
+			return err
+		}
+	}
+	if err := opts.WarkDependencies(dag, func(ancestor, descendant *Task) error {
+		return g.AddEdge(ancestor.ID(), descendant.ID(), true, edgeAttrs)
+	}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, g.String())
+	return err
+}
+
+func renderMermaid(w io.Writer, dag *DAG, opts RenderOptions) error {
+	var builder strings.Builder
+	builder.WriteString("graph LR\n")
+	tasks := opts.Tasks(dag)
+	for _, task := range tasks {
+		id := task.ID()
+		label := id
+		if description := task.Description(); description != "" {
+			label += "<br/>" + escapeMermaidLabel(description)
+		}
+		fmt.Fprintf(&builder, "    %s(\"%s\")\n", renderID(id), label)
+	}
+	for _, task := range tasks {
+		if links := task.Links(); len(links) > 0 {
+			fmt.Fprintf(&builder, "    click %s href \"%s\" \"%s\"\n", renderID(task.ID()), escapeMermaidLabel(links[0].URL), escapeMermaidLabel(task.metadataSummary()))
+		}
+	}
+	builder.WriteRune('\n')
+	if err := opts.WarkDependencies(dag, func(ancestor, descendant *Task) error {
+		fmt.Fprintf(&builder, "    %s-->%s\n", renderID(ancestor.ID()), renderID(descendant.ID()))
+		return nil
+
+	}); err != nil {
+		return err
+	}
+	if len(opts.TaskStates) > 0 {
+		builder.WriteRune('\n')
+		for _, state := range renderTaskStates {
+			fmt.Fprintf(&builder, "    classDef %s fill:%s\n", state, taskStateColors[state])
+		}
+		for _, task := range tasks {
+			if state, ok := opts.TaskStates[task.ID()]; ok {
+				fmt.Fprintf(&builder, "    class %s %s\n", renderID(task.ID()), state)
+			}
+		}
+	}
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func escapeMermaidLabel(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "\n", " / ").Replace(s)
+}
+
+func renderMarkdown(w io.Writer, dag *DAG, opts RenderOptions) error {
+	var builder strings.Builder
+	builder.WriteString("```mermaid\n")
+	if err := renderMermaid(&builder, dag, opts); err != nil {
+		return err
+	}
+	builder.WriteString("```\n")
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func renderPlantUML(w io.Writer, dag *DAG, opts RenderOptions) error {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "@startuml %s\n", renderID(dag.ID()))
+	builder.WriteString("left to right direction\n")
+	for _, task := range opts.Tasks(dag) {
+		fmt.Fprintf(&builder, "rectangle \"%s\" as %s", task.ID(), renderID(task.ID()))
+		if state, ok := opts.TaskStates[task.ID()]; ok {
+			fmt.Fprintf(&builder, " %s", taskStateColors[state])
+		}
+		builder.WriteRune('\n')
+	}
+	if err := opts.WarkDependencies(dag, func(ancestor, descendant *Task) error {
+		fmt.Fprintf(&builder, "%s --> %s\n", renderID(ancestor.ID()), renderID(descendant.ID()))
+		return nil
+	}); err != nil {
+		return err
+	}
+	builder.WriteString("@enduml\n")
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func renderD2(w io.Writer, dag *DAG, opts RenderOptions) error {
+	var builder strings.Builder
+	builder.WriteString("direction: right\n")
+	for _, task := range opts.Tasks(dag) {
+		fmt.Fprintf(&builder, "%q", task.ID())
+		fields := make([]string, 0, 3)
+		if state, ok := opts.TaskStates[task.ID()]; ok {
+			fields = append(fields, fmt.Sprintf("style.fill: %q", taskStateColors[state]))
+		}
+		if summary := task.metadataSummary(); summary != "" {
+			fields = append(fields, fmt.Sprintf("tooltip: %q", summary))
+		}
+		if links := task.Links(); len(links) > 0 {
+			fields = append(fields, fmt.Sprintf("link: %q", links[0].URL))
+		}
+		if len(fields) > 0 {
+			fmt.Fprintf(&builder, ": {%s}", strings.Join(fields, "; "))
+		}
+		builder.WriteRune('\n')
+	}
+	if err := opts.WarkDependencies(dag, func(ancestor, descendant *Task) error {
+		fmt.Fprintf(&builder, "%q -> %q\n", ancestor.ID(), descendant.ID())
+		return nil
+	}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+type renderGraph struct {
+	DAGID string            `json:"DAGId"`
+	Nodes []renderGraphNode `json:"Nodes"`
+	Edges []renderGraphEdge `json:"Edges"`
+}
+
+type renderGraphNode struct {
+	TaskID      string     `json:"TaskId"`
+	State       TaskState  `json:"State,omitempty"`
+	Description string     `json:"Description,omitempty"`
+	Owner       string     `json:"Owner,omitempty"`
+	Tags        []string   `json:"Tags,omitempty"`
+	Docs        string     `json:"Docs,omitempty"`
+	Links       []TaskLink `json:"Links,omitempty"`
+}
+
+type renderGraphEdge struct {
+	From string `json:"From"`
+	To   string `json:"To"`
+}
+
+func renderJSON(w io.Writer, dag *DAG, opts RenderOptions) error {
+	graph := renderGraph{
+		DAGID: dag.ID(),
+		Nodes: make([]renderGraphNode, 0),
+		Edges: make([]renderGraphEdge, 0),
+	}
+	for _, task := range opts.Tasks(dag) {
+		graph.Nodes = append(graph.Nodes, renderGraphNode{
+			TaskID:      task.ID(),
+			State:       opts.TaskStates[task.ID()],
+			Description: task.Description(),
+			Owner:       task.Owner(),
+			Tags:        task.Tags(),
+			Docs:        task.Docs(),
+			Links:       task.Links(),
+		})
+	}
+	if err := opts.WarkDependencies(dag, func(ancestor, descendant *Task) error {
+		graph.Edges = append(graph.Edges, renderGraphEdge{From: ancestor.ID(), To: descendant.ID()})
+		return nil
+	}); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(graph)
+}
+
+// taskLayers groups the tasks to render by the layer, the layer of a task is the longest distance from the start tasks.
+func (opts RenderOptions) taskLayers(dag *DAG) [][]*Task {
+	layers := make(map[string]int)
+	var layerOf func(task *Task) int
+	layerOf = func(task *Task) int {
+		if layer, ok := layers[task.ID()]; ok {
+			return layer
+		}
+		layer := 0
+		for _, upstream := range dag.GetUpstreamTasks(task.ID()) {
+			if l := layerOf(upstream) + 1; l > layer {
+				layer = l
+			}
+		}
+		layers[task.ID()] = layer
+		return layer
+	}
+	tasksByLayer := make([][]*Task, 0)
+	for _, task := range opts.Tasks(dag) {
+		layer := layerOf(task)
+		for len(tasksByLayer) <= layer {
+			tasksByLayer = append(tasksByLayer, nil)
+		}
+		tasksByLayer[layer] = append(tasksByLayer[layer], task)
+	}
+	return lo.Filter(tasksByLayer, func(tasks []*Task, _ int) bool {
+		return len(tasks) > 0
+	})
+}
+
+func renderGantt(w io.Writer, dag *DAG, opts RenderOptions) error {
+	if opts.DAGRunContext == nil {
+		return errors.New("gantt format requires the DAG run context")
+	}
+	return RenderMermaidGantt(w, dag.ID(), opts.DAGRunContext)
+}
+
+func renderGanttHTML(w io.Writer, dag *DAG, opts RenderOptions) error {
+	if opts.DAGRunContext == nil {
+		return errors.New("gantt-html format requires the DAG run context")
+	}
+	return RenderGanttHTML(w, dag.ID(), opts.DAGRunContext)
+}
@@ -0,0 +1,262 @@
+package lambdag_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAGRender(t *testing.T) {
+	dag, err := lambdag.NewDAG("RenderDAG")
+	require.NoError(t, err)
+	handler := lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return nil, nil
+	})
+	// task1 ─> task2 ─> task4
+	//       └> task3 ┘
+	task1, err := dag.NewTask("task1", handler)
+	require.NoError(t, err)
+	task2, err := dag.NewTask("task2", handler)
+	require.NoError(t, err)
+	task3, err := dag.NewTask("task3", handler)
+	require.NoError(t, err)
+	task4, err := dag.NewTask("task4", handler)
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2, task3))
+	require.NoError(t, task4.SetUpstream(task2, task3))
+	states := map[string]lambdag.TaskState{
+		"task1": lambdag.TaskStateDone,
+		"task2": lambdag.TaskStateFailed,
+		"task3": lambdag.TaskStateExecutable,
+		"task4": lambdag.TaskStateSkipped,
+	}
+	cases := []struct {
+		format   string
+		opts     lambdag.RenderOptions
+		expected string
+	}{
+		{
+			format: "plantuml",
+			opts:   lambdag.RenderOptions{TaskStates: states},
+			expected: `@startuml RenderDAG
+left to right direction
+rectangle "task1" as task1 #a3e4a3
+rectangle "task2" as task2 #ff9e9e
+rectangle "task3" as task3 #9ecbff
+rectangle "task4" as task4 #d9d9d9
+task1 --> task2
+task1 --> task3
+task2 --> task4
+task3 --> task4
+@enduml
+`,
+		},
+		{
+			format: "dot",
+			opts:   lambdag.RenderOptions{TaskStates: map[string]lambdag.TaskState{"task2": lambdag.TaskStateFailed}},
+			expected: `digraph RenderDAG {
+	task1->task2[ arrowhead=vee ];
+	task1->task3[ arrowhead=vee ];
+	task2->task4[ arrowhead=vee ];
+	task3->task4[ arrowhead=vee ];
+	task1 [ shape="ellipse", style="filled" ];
+	task2 [ fillcolor="#ff9e9e", shape="ellipse", style="filled" ];
+	task3 [ shape="ellipse", style="filled" ];
+	task4 [ shape="ellipse", style="filled" ];
+
+}
+`,
+		},
+		{
+			format: "d2",
+			expected: `direction: right
+"task1"
+"task2"
+"task3"
+"task4"
+"task1" -> "task2"
+"task1" -> "task3"
+"task2" -> "task4"
+"task3" -> "task4"
+`,
+		},
+		{
+			format: "json",
+			opts:   lambdag.RenderOptions{TaskStates: states},
+			expected: `{
+  "DAGId": "RenderDAG",
+  "Nodes": [
+    {
+      "TaskId": "task1",
+      "State": "done"
+    },
+    {
+      "TaskId": "task2",
+      "State": "failed"
+    },
+    {
+      "TaskId": "task3",
+      "State": "executable"
+    },
+    {
+      "TaskId": "task4",
+      "State": "skipped"
+    }
+  ],
+  "Edges": [
+    {
+      "From": "task1",
+      "To": "task2"
+    },
+    {
+      "From": "task1",
+      "To": "task3"
+    },
+    {
+      "From": "task2",
+      "To": "task4"
+    },
+    {
+      "From": "task3",
+      "To": "task4"
+    }
+  ]
+}
+`,
+		},
+		{
+			format: "ascii",
+			expected: `RenderDAG
+[task1]
+   |
+   +--------+
+   v        v
+[task2]  [task3]
+   |        |
+   +----+   |
+        +---+
+        v
+     [task4]
+`,
+		},
+		{
+			format: "ascii",
+			opts:   lambdag.RenderOptions{TaskStates: states},
+			expected: `RenderDAG
+ [task1: done]
+       |
+       +------------------+
+       v                  v
+[task2: failed]  [task3: executable]
+       |                  |
+       +---------+        |
+                 +--------+
+                 v
+         [task4: skipped]
+`,
+		},
+		{
+			format: "mermaid",
+			opts:   lambdag.RenderOptions{TaskStates: map[string]lambdag.TaskState{"task1": lambdag.TaskStateDone}},
+			expected: `graph LR
+    task1("task1")
+    task2("task2")
+    task3("task3")
+    task4("task4")
+
+    task1-->task2
+    task1-->task3
+    task2-->task4
+    task3-->task4
+
+    classDef done fill:#a3e4a3
+    classDef pending fill:#ffffff
+    classDef executable fill:#9ecbff
+    classDef failed fill:#ff9e9e
+    classDef skipped fill:#d9d9d9
+    class task1 done
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.format, func(t *testing.T) {
+			var builder strings.Builder
+			require.NoError(t, dag.Render(&builder, c.format, c.opts))
+			require.EqualValues(t, c.expected, builder.String())
+		})
+	}
+
+	t.Run("ascii across layers", func(t *testing.T) {
+		handled := make([]string, 0)
+		dag := newChainDAG(t, []string{"task1", "task2", "task3"}, &handled)
+		task1, ok := dag.GetTask("task1")
+		require.True(t, ok)
+		task3, ok := dag.GetTask("task3")
+		require.True(t, ok)
+		require.NoError(t, task1.SetDownstream(task3))
+		var builder strings.Builder
+		require.NoError(t, dag.Render(&builder, "ascii", lambdag.RenderOptions{}))
+		expected := `ChainDAG
+[task1]
+   |
+   +-----+
+   v     |
+[task2]  |
+   |     |
+   +--+  |
+      +--+
+      v
+   [task3]
+`
+		require.EqualValues(t, expected, builder.String())
+	})
+
+	t.Run("html", func(t *testing.T) {
+		var builder strings.Builder
+		require.NoError(t, dag.Render(&builder, "html", lambdag.RenderOptions{
+			TaskStates: map[string]lambdag.TaskState{"task1": lambdag.TaskStateDone},
+		}))
+		html := builder.String()
+		require.Contains(t, html, `<g class="node" data-task="task4">`)
+		require.Contains(t, html, `<path class="edge" data-from="task2" data-to="task4"`)
+		require.Contains(t, html, `fill="#a3e4a3"`)
+		require.Contains(t, html, `"task4":{"Upstream":["task2","task3"],"Downstream":[]`)
+		require.NotContains(t, html, "<script src=", "the viewer must not load external resources")
+		require.NotContains(t, html, "https://")
+	})
+}
+
+func TestDAGRenderErrors(t *testing.T) {
+	handled := make([]string, 0)
+	dag := newChainDAG(t, []string{"task1", "task2"}, &handled)
+	require.Error(t, dag.Render(io.Discard, "unknown", lambdag.RenderOptions{}))
+	require.Error(t, dag.Render(io.Discard, "gantt", lambdag.RenderOptions{}))
+}
+
+func TestRegisterRenderer(t *testing.T) {
+	t.Cleanup(func() {
+		lambdag.UnregisterRenderer("task-list")
+	})
+	lambdag.RegisterRenderer("task-list", lambdag.RendererFunc(func(w io.Writer, dag *lambdag.DAG, opts lambdag.RenderOptions) error {
+		for _, task := range dag.GetAllTasks() {
+			fmt.Fprintln(w, task.ID())
+		}
+		return nil
+	}))
+	require.Contains(t, lambdag.RenderFormats(), "task-list")
+	handled := make([]string, 0)
+	dag := newChainDAG(t, []string{"task1", "task2"}, &handled)
+	var builder strings.Builder
+	require.NoError(t, dag.Render(&builder, "task-list", lambdag.RenderOptions{}))
+	require.EqualValues(t, "task1\ntask2\n", builder.String())
+
+	lambdag.UnregisterRenderer("task-list")
+	require.NotContains(t, lambdag.RenderFormats(), "task-list")
+	require.Error(t, dag.Render(io.Discard, "task-list", lambdag.RenderOptions{}))
+
+}
@@ -0,0 +1,166 @@
+package lambdag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ResponseStore is a storage for task responses that are too large to carry in DAGRunContext.
+// PutResponse returns a reference, and GetResponse resolves the reference to the stored data.
+type ResponseStore interface {
+	PutResponse(ctx context.Context, key string, data []byte) (ref string, err error)
+	GetResponse(ctx context.Context, ref string) (data []byte, err error)
+}
+
+func WithResponseStore(store ResponseStore, thresholdBytes int) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		if store == nil {
+			return errors.New("response store is nil")
+		}
+		opts.responseStore = store
+		opts.responseStoreThreshold = thresholdBytes
+		return nil
+	}
+}
+
+// FileResponseStore stores task responses under dir.
+// References outside of dir are rejected, because they come from the payload of the invocation.
+type FileResponseStore struct {
+	dir string
+}
+
+func NewFileResponseStore(dir string) (*FileResponseStore, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FileResponseStore{dir: absDir}, nil
+}
+
+func (s *FileResponseStore) PutResponse(_ context.Context, key string, data []byte) (string, error) {
+	name, err := s.resolve(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		return "", err
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(name)}
+	return u.String(), nil
+}
+
+func (s *FileResponseStore) GetResponse(_ context.Context, ref string) ([]byte, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" || u.Host != "" {
+		return nil, fmt.Errorf("unsupported response reference `%s`", ref)
+	}
+	name, err := s.resolve(filepath.FromSlash(u.Path))
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(name)
+}
+
+// resolve returns the cleaned file name, which must be inside the store directory.
+func (s *FileResponseStore) resolve(name string) (string, error) {
+	name = filepath.Clean(name)
+	rel, err := filepath.Rel(s.dir, name)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("`%s` is outside of the response store", name)
+	}
+	return name, nil
+}
+
+// S3Client is the subset of the S3 API used by S3ResponseStore.
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// S3ResponseStore stores task responses under the prefix of the bucket.
+// References to other buckets or outside of the prefix are rejected, because they come from the payload of the invocation.
+type S3ResponseStore struct {
+	client S3Client
+	bucket string
+	prefix string
+}
+
+func NewS3ResponseStore(client S3Client, bucket string, prefix string) *S3ResponseStore {
+	return &S3ResponseStore{
+		client: client,
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+	}
+}
+
+func (s *S3ResponseStore) PutResponse(ctx context.Context, key string, data []byte) (string, error) {
+	objectKey, err := s.checkObjectKey(path.Join(s.prefix, key))
+	if err != nil {
+		return "", err
+	}
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(objectKey),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{Scheme: "s3", Host: s.bucket, Path: "/" + objectKey}
+	return u.String(), nil
+}
+
+func (s *S3ResponseStore) GetResponse(ctx context.Context, ref string) ([]byte, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "s3" {
+		return nil, fmt.Errorf("unsupported response reference `%s`", ref)
+	}
+	if u.Host != s.bucket {
+		return nil, fmt.Errorf("response reference `%s` is outside of the bucket `%s`", ref, s.bucket)
+	}
+	objectKey, err := s.checkObjectKey(strings.TrimPrefix(u.Path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+// checkObjectKey checks that the object key is a clean key under the prefix.
+func (s *S3ResponseStore) checkObjectKey(objectKey string) (string, error) {
+	if objectKey == "" || path.Clean("/"+objectKey) != "/"+objectKey {
+		return "", fmt.Errorf("invalid object key `%s`", objectKey)
+	}
+	if s.prefix != "" && !strings.HasPrefix(objectKey, s.prefix+"/") {
+		return "", fmt.Errorf("object key `%s` is outside of the prefix `%s`", objectKey, s.prefix)
+	}
+	return objectKey, nil
+}
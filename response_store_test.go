@@ -0,0 +1,179 @@
+package lambdag_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func invokeUntilEnd(t *testing.T, handler lambda.Handler, payload []byte) lambdag.DAGRunContext {
+	t.Helper()
+	var dagRunCtx lambdag.DAGRunContext
+	for i := 0; i < 10; i++ {
+		resp, err := handler.Invoke(context.Background(), payload)
+		require.NoError(t, err)
+		t.Logf("invoke[%d] resp: %s", i, string(resp))
+		require.NoError(t, json.Unmarshal(resp, &dagRunCtx))
+		if !dagRunCtx.Continue {
+			break
+		}
+		payload = resp
+	}
+	return dagRunCtx
+}
+
+type s3StandIn struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		bs, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.objects[r.URL.Path] = bs
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		bs, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(bs)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newS3StandInClient(t *testing.T, standIn *s3StandIn) *s3.Client {
+	t.Helper()
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		Credentials:  aws.AnonymousCredentials{},
+		UsePathStyle: true,
+		EndpointResolver: s3.EndpointResolverFunc(func(_ string, _ s3.EndpointResolverOptions) (aws.Endpoint, error) {
+			return aws.Endpoint{
+				URL:               server.URL,
+				SigningRegion:     "us-east-1",
+				HostnameImmutable: true,
+			}, nil
+		}),
+	})
+}
+
+func TestResponseStore(t *testing.T) {
+	fileStore, err := lambdag.NewFileResponseStore(t.TempDir())
+	require.NoError(t, err)
+	standIn := &s3StandIn{objects: make(map[string][]byte)}
+	s3Store := lambdag.NewS3ResponseStore(newS3StandInClient(t, standIn), "lambdag-test", "responses/")
+	cases := []struct {
+		name  string
+		store lambdag.ResponseStore
+		check func(t *testing.T, dagRunID string, stored string)
+	}{
+		{
+			name:  "file",
+			store: fileStore,
+			check: func(t *testing.T, _ string, stored string) {
+				require.Contains(t, stored, `"Ref":"file://`)
+			},
+		},
+		{
+			name:  "s3",
+			store: s3Store,
+			check: func(t *testing.T, dagRunID string, stored string) {
+				ref := "s3://lambdag-test/responses/ResponseStoreDAG/" + dagRunID + "/task1.json"
+				require.JSONEq(t, `{"LambDAGEnvelope":{"Version":1,"Ref":"`+ref+`"}}`, stored)
+				require.JSONEq(t, `{"Message":"`+strings.Repeat("x", 64)+`"}`, string(standIn.objects["/lambdag-test/responses/ResponseStoreDAG/"+dagRunID+"/task1.json"]))
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dag, err := lambdag.NewDAG("ResponseStoreDAG", lambdag.WithResponseStore(c.store, 32))
+			require.NoError(t, err)
+			var received string
+			task1, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+				return map[string]string{"Message": strings.Repeat("x", 64)}, nil
+			}))
+			require.NoError(t, err)
+			task2, err := dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+				received = string(tr.TaskResponses["task1"])
+				return "ok", nil
+			}))
+			require.NoError(t, err)
+			require.NoError(t, task1.SetDownstream(task2))
+			dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+
+			require.JSONEq(t, `{"Message":"`+strings.Repeat("x", 64)+`"}`, received)
+			require.EqualValues(t, `"ok"`, string(dagRunCtx.TaskResponses["task2"]))
+			c.check(t, dagRunCtx.DAGRunID, string(dagRunCtx.TaskResponses["task1"]))
+		})
+	}
+}
+
+func TestResponseStoreRejectsOutsideReferences(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(outside, []byte(`"secret"`), 0644))
+	fileStore, err := lambdag.NewFileResponseStore(dir)
+	require.NoError(t, err)
+	for _, ref := range []string{
+		"file://" + filepath.ToSlash(outside),
+		"file://" + filepath.ToSlash(dir) + "/../" + filepath.Base(filepath.Dir(outside)) + "/secret.txt",
+		"file://" + filepath.ToSlash(dir),
+		"file://localhost" + filepath.ToSlash(outside),
+	} {
+		_, err := fileStore.GetResponse(context.Background(), ref)
+		require.Error(t, err, ref)
+	}
+	_, err = fileStore.PutResponse(context.Background(), "../escaped.json", []byte(`"data"`))
+	require.Error(t, err)
+
+	s3Store := lambdag.NewS3ResponseStore(nil, "lambdag-test", "responses/")
+	for _, ref := range []string{
+		"s3://other-bucket/responses/task1.json",
+		"s3://lambdag-test/other/task1.json",
+		"s3://lambdag-test/responses/../other/task1.json",
+	} {
+		_, err := s3Store.GetResponse(context.Background(), ref)
+		require.Error(t, err, ref)
+	}
+	_, err = s3Store.PutResponse(context.Background(), "../other/task1.json", []byte(`"data"`))
+	require.Error(t, err)
+
+	// a crafted payload can not make the downstream task read the file outside of the store.
+	handled := make([]string, 0)
+	dag := newChainDAG(t, []string{"task1", "task2"}, &handled, lambdag.WithResponseStore(fileStore, 32))
+	_, err = dag.Execute(context.Background(), &lambdag.DAGRunContext{
+		DAGRunID: "test-run",
+		TaskResponses: map[string]json.RawMessage{
+			"task1": json.RawMessage(`{"LambDAGEnvelope":{"Version":1,"Ref":"file://` + filepath.ToSlash(outside) + `"}}`),
+		},
+	})
+	require.ErrorContains(t, err, "outside of the response store")
+	require.Empty(t, handled)
+}
@@ -2,6 +2,7 @@ package lambdag
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -12,10 +13,11 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"text/tabwriter"
 
-	"github.com/awalterschulze/gographviz"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/google/subcommands"
+	"github.com/samber/lo"
 )
 
 func Run(args []string, dag *DAG) error {
@@ -28,10 +30,15 @@ func RunWithContext(ctx context.Context, args []string, dag *DAG) error {
 		lambda.StartWithOptions(handler, lambda.WithContext(ctx))
 		return nil
 	} else {
+		defer func() {
+			if err := dag.Shutdown(ctx); err != nil {
+				log.Println("[warn] shutdown:", err)
+			}
+		}()
 		commander, fs := newCommander(args, dag)
 		fs.Parse(args)
 		switch commander.Execute(ctx) {
-		case subcommands.ExitSuccess:
+		case subcommands.ExitFailure:
 			return errors.New("execute failed")
 		case subcommands.ExitUsageError:
 			return errors.New("usage error")
@@ -55,6 +62,7 @@ func newCommander(args []string, dag *DAG) (*subcommands.Commander, *flag.FlagSe
 	commander.Register(commander.CommandsCommand(), "")
 	commander.Register(&serveCommand{dag: dag, commander: commander}, "")
 	commander.Register(&renderCommand{dag: dag, commander: commander}, "")
+	commander.Register(&tasksCommand{dag: dag, commander: commander}, "")
 	return commander, fs
 }
 
@@ -63,6 +71,7 @@ type serveCommand struct {
 	dag                *DAG
 	port               int
 	lambdaFunctionName string
+	metrics            bool
 }
 
 func (cmd *serveCommand) Name() string     { return "serve" }
@@ -70,6 +79,7 @@ func (cmd *serveCommand) Synopsis() string { return "start a stub server for the
 func (cmd *serveCommand) SetFlags(fs *flag.FlagSet) {
 	fs.IntVar(&cmd.port, "port", 3001, "stub server port")
 	fs.StringVar(&cmd.lambdaFunctionName, "lambda-function-name", cmd.dag.ID(), "stub lambda function name")
+	fs.BoolVar(&cmd.metrics, "metrics", false, "collect metrics in memory, and serve them as JSON on GET /lambdag/metrics")
 }
 func (cmd *serveCommand) Usage() string {
 	return fmt.Sprintf(`serve [options]:
@@ -93,7 +103,15 @@ func (cmd *serveCommand) Execute(ctx context.Context, fs *flag.FlagSet, _ ...int
 	if err != nil {
 		l.Printf("[error] couldn't listen to %s: %s", address, err.Error())
 	}
-	srv := http.Server{Handler: NewLambdaAPIStubMux(cmd.lambdaFunctionName, NewLambdaHandler(cmd.dag))}
+	var handler http.Handler = NewLambdaAPIStubMux(cmd.lambdaFunctionName, NewLambdaHandler(cmd.dag))
+	if cmd.metrics {
+		sink := NewInMemoryMetricsSink()
+		mux := http.NewServeMux()
+		mux.Handle("/", NewLambdaAPIStubMux(cmd.lambdaFunctionName, newMetricsSinkHandler(NewLambdaHandler(cmd.dag), sink)))
+		mux.Handle("/lambdag/metrics", sink)
+		handler = mux
+	}
+	srv := http.Server{Handler: handler}
 	var wg sync.WaitGroup
 	wg.Add(2)
 	go func() {
@@ -116,16 +134,38 @@ type renderCommand struct {
 	commander *subcommands.Commander
 	dag       *DAG
 	format    string
+	run       string
+	state     string
+	tags      string
 }
 
 func (cmd *renderCommand) Name() string     { return "render" }
 func (cmd *renderCommand) Synopsis() string { return "rendering DAG" }
 func (cmd *renderCommand) SetFlags(fs *flag.FlagSet) {
-	fs.StringVar(&cmd.format, "format", "markdown", "rendering format (markdown|mermaid|dot)")
+	fs.StringVar(&cmd.format, "format", "markdown", fmt.Sprintf("rendering format (%s)", strings.Join(RenderFormats(), "|")))
+	fs.StringVar(&cmd.run, "run", "", "DAG run context JSON file of the finished DAG run, required for gantt formats (- for stdin)")
+	fs.StringVar(&cmd.state, "state", "", "DAG run context JSON file, colors the tasks by the status in the DAG run (- for stdin)")
+	fs.StringVar(&cmd.tags, "tags", "", "comma separated tags, renders only the tasks which have any of the tags")
 }
 func (cmd *renderCommand) Usage() string {
 	return `render [options]:
 	Renders the DAG as some form of...
+
+	gantt formats render the DAG run, for example:
+
+	render -format gantt -run run.json
+
+	-state colors the tasks by the status (done, pending, executable, failed or skipped) in the DAG run:
+
+	render -format mermaid -state payload.json
+
+	The payload may be the DAG run reference, if the DAG has the DAG run state store.
+	Without the store, the failed invocation does not return the DAG run context,
+	so failed and skipped tasks are shown only with the DAG run state store.
+
+	-tags renders only the tasks which have any of the tags:
+
+	render -format dot -tags etl,report
 `
 }
 
@@ -134,83 +174,276 @@ func (cmd *renderCommand) Execute(ctx context.Context, fs *flag.FlagSet, _ ...in
 		cmd.commander.ExplainCommand(cmd.commander.Output, cmd)
 		return subcommands.ExitSuccess
 	}
-	switch cmd.format {
-	case "markdown":
-		return cmd.renderMarkdown(ctx, os.Stdout)
-	case "mermaid":
-		return cmd.renderMermaid(ctx, os.Stdout)
-	case "dot":
-		return cmd.renderDOT(ctx, os.Stdout)
-	}
-	log.Println("[error] unknown format")
-	return subcommands.ExitFailure
-}
-
-func (cmd *renderCommand) renderDOT(ctx context.Context, stdout io.Writer) subcommands.ExitStatus {
-	g := gographviz.NewGraph()
-	graphName := cmd.dag.ID()
-	nodeAttrs := make(map[string]string)
-	edgeAttrs := make(map[string]string)
-	edgeAttrs["arrowhead"] = "vee"
-	if err := g.SetName(graphName); err != nil {
-		log.Println("[error] ", err)
-		return subcommands.ExitFailure
+	var opts RenderOptions
+	if cmd.tags != "" {
+		opts.Tags = splitTags(cmd.tags)
+		if len(cmd.dag.GetTasksByTag(opts.Tags...)) == 0 {
+			log.Printf("[error] no task has the tags `%s`", cmd.tags)
+			return subcommands.ExitFailure
+		}
 	}
-	if err := g.SetDir(true); err != nil {
+	if cmd.state != "" {
+		dagRunCtx, err := loadDAGRunContext(ctx, cmd.dag, cmd.state)
+		if err != nil {
+			log.Println("[error] ", err)
+			return subcommands.ExitFailure
+		}
+		if dagRunCtx.DAGFingerprint != "" && dagRunCtx.DAGFingerprint != cmd.dag.Fingerprint() {
+			log.Printf("[error] dag run `%s` is not the run of the current DAG definition: fingerprint %s, expected %s", dagRunCtx.DAGRunID, dagRunCtx.DAGFingerprint, cmd.dag.Fingerprint())
+			return subcommands.ExitFailure
+		}
+		opts.TaskStates = cmd.dag.TaskStates(dagRunCtx)
+	}
+	if cmd.run != "" {
+		dagRunCtx, err := loadDAGRunContext(ctx, cmd.dag, cmd.run)
+		if err != nil {
+			log.Println("[error] ", err)
+			return subcommands.ExitFailure
+		}
+		opts.DAGRunContext = dagRunCtx
+	}
+	if err := cmd.dag.Render(os.Stdout, cmd.format, opts); err != nil {
 		log.Println("[error] ", err)
 		return subcommands.ExitFailure
 	}
-	tasks := cmd.dag.GetAllTasks()
-	for _, task := range tasks {
-		nodeAttrs["shape"] = `"ellipse"`
-		nodeAttrs["style"] = `"filled"`
-		nodeName := task.ID()
-		if err := g.AddNode(graphName, nodeName, nodeAttrs); err != nil {
+	return subcommands.ExitSuccess
+}
+
+type tasksCommand struct {
+	commander *subcommands.Commander
+	dag       *DAG
+	format    string
+	recursive bool
+	tags      string
+}
+
+func (cmd *tasksCommand) Name() string     { return "tasks" }
+func (cmd *tasksCommand) Synopsis() string { return "inspecting tasks of DAG" }
+func (cmd *tasksCommand) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cmd.format, "format", "text", "output format (text|json)")
+	fs.BoolVar(&cmd.recursive, "recursive", false, "upstream and downstream show all ancestor or descendant tasks")
+	fs.StringVar(&cmd.tags, "tags", "", "comma separated tags, list, upstream and downstream show only the tasks which have any of the tags")
+}
+func (cmd *tasksCommand) Usage() string {
+	return `tasks [options] <list|show|upstream|downstream> [task_id]:
+	Inspects the tasks of the DAG.
+
+	list                 lists all tasks
+	show <task_id>       shows the task with its metadata, upstream and downstream tasks
+	upstream <task_id>   lists the upstream tasks, or all ancestor tasks with -recursive
+	downstream <task_id> lists the downstream tasks, or all descendant tasks with -recursive
+
+	for example, what runs before task3:
+
+	tasks -recursive upstream task3
+
+	-tags filters the tasks of list, upstream and downstream, show does not accept -tags:
+
+	tasks -recursive -tags etl upstream task3
+`
+}
+
+// taskSummary is the task shown by the tasks command.
+type taskSummary struct {
+	TaskID      string     `json:"TaskId"`
+	Description string     `json:"Description,omitempty"`
+	Owner       string     `json:"Owner,omitempty"`
+	Tags        []string   `json:"Tags,omitempty"`
+	Docs        string     `json:"Docs,omitempty"`
+	Links       []TaskLink `json:"Links,omitempty"`
+	Upstream    []string   `json:"Upstream"`
+	Downstream  []string   `json:"Downstream"`
+}
+
+func (cmd *tasksCommand) summary(task *Task) taskSummary {
+	return taskSummary{
+		TaskID:      task.ID(),
+		Description: task.Description(),
+		Owner:       task.Owner(),
+		Tags:        task.Tags(),
+		Docs:        task.Docs(),
+		Links:       task.Links(),
+		Upstream:    taskIDs(cmd.dag.GetUpstreamTasks(task.ID())),
+		Downstream:  taskIDs(cmd.dag.GetDownstreamTasks(task.ID())),
+	}
+}
+
+func (cmd *tasksCommand) Execute(ctx context.Context, fs *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if fs.Arg(0) == "help" || fs.NArg() == 0 {
+		cmd.commander.ExplainCommand(cmd.commander.Output, cmd)
+		if fs.NArg() == 0 {
+			return subcommands.ExitUsageError
+		}
+		return subcommands.ExitSuccess
+	}
+	if cmd.format != "text" && cmd.format != "json" {
+		log.Printf("[error] unknown format `%s`", cmd.format)
+		return subcommands.ExitUsageError
+	}
+	action := fs.Arg(0)
+	if action == "list" {
+		if err := cmd.list(os.Stdout); err != nil {
 			log.Println("[error] ", err)
 			return subcommands.ExitFailure
 		}
+		return subcommands.ExitSuccess
+	}
+	if action != "show" && action != "upstream" && action != "downstream" {
+		log.Printf("[error] unknown action `%s`", action)
+		return subcommands.ExitUsageError
 	}
-	if err := cmd.dag.WarkAllDependencies(func(ancestor, descendant *Task) error {
-		return g.AddEdge(ancestor.ID(), descendant.ID(), true, edgeAttrs)
-	}); err != nil {
+	if fs.NArg() != 2 {
+		log.Printf("[error] %s requires task_id", action)
+		return subcommands.ExitUsageError
+	}
+	if action == "show" && cmd.tags != "" {
+		log.Println("[error] show does not accept -tags")
+		return subcommands.ExitUsageError
+	}
+	task, ok := cmd.dag.GetTask(fs.Arg(1))
+	if !ok {
+		log.Printf("[error] task `%s` not found", fs.Arg(1))
+		return subcommands.ExitFailure
+	}
+	var err error
+	switch action {
+	case "show":
+		err = cmd.show(os.Stdout, task)
+	case "upstream":
+		tasks := cmd.dag.GetUpstreamTasks(task.ID())
+		if cmd.recursive {
+			tasks = cmd.dag.GetAncestorTasks(task.ID())
+		}
+		err = cmd.writeTaskIDs(os.Stdout, tasks)
+	case "downstream":
+		tasks := cmd.dag.GetDownstreamTasks(task.ID())
+		if cmd.recursive {
+			tasks = cmd.dag.GetDescendantTasks(task.ID())
+		}
+		err = cmd.writeTaskIDs(os.Stdout, tasks)
+	}
+	if err != nil {
 		log.Println("[error] ", err)
 		return subcommands.ExitFailure
 	}
-	io.WriteString(stdout, g.String())
 	return subcommands.ExitSuccess
 }
 
-func (cmd *renderCommand) renderMermaid(ctx context.Context, stdout io.Writer) subcommands.ExitStatus {
-	var builder strings.Builder
-	builder.WriteString("graph LR\n")
+func (cmd *tasksCommand) list(w io.Writer) error {
 	tasks := cmd.dag.GetAllTasks()
-	convert := func(id string) string {
-		return strings.ReplaceAll(strings.ReplaceAll(id, " ", "_"), "-", "_")
+	if cmd.tags != "" {
+		tasks = cmd.dag.GetTasksByTag(splitTags(cmd.tags)...)
 	}
+	if cmd.format == "json" {
+		summaries := make([]taskSummary, 0, len(tasks))
+		for _, task := range tasks {
+			summaries = append(summaries, cmd.summary(task))
+		}
+		return writeJSON(w, summaries)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TASK\tUPSTREAM\tOWNER\tTAGS\tDESCRIPTION")
 	for _, task := range tasks {
-		id := task.ID()
-		fmt.Fprintf(&builder, "    %s(\"%s\")\n", convert(id), id)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			task.ID(),
+			strings.Join(taskIDs(cmd.dag.GetUpstreamTasks(task.ID())), ","),
+			task.Owner(),
+			strings.Join(task.Tags(), ","),
+			task.Description(),
+		)
 	}
-	builder.WriteRune('\n')
-	if err := cmd.dag.WarkAllDependencies(func(ancestor, descendant *Task) error {
-		fmt.Fprintf(&builder, "    %s-->%s\n", convert(ancestor.ID()), convert(descendant.ID()))
-		return nil
+	return tw.Flush()
+}
 
-	}); err != nil {
-		log.Println("[error] ", err)
-		return subcommands.ExitFailure
+func (cmd *tasksCommand) show(w io.Writer, task *Task) error {
+	summary := cmd.summary(task)
+	if cmd.format == "json" {
+		return writeJSON(w, summary)
 	}
-	io.WriteString(stdout, builder.String())
-	return subcommands.ExitSuccess
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Task:        %s\n", summary.TaskID)
+	if summary.Description != "" {
+		fmt.Fprintf(&builder, "Description: %s\n", summary.Description)
+	}
+	if summary.Owner != "" {
+		fmt.Fprintf(&builder, "Owner:       %s\n", summary.Owner)
+	}
+	if len(summary.Tags) > 0 {
+		fmt.Fprintf(&builder, "Tags:        %s\n", strings.Join(summary.Tags, ", "))
+	}
+	fmt.Fprintf(&builder, "Upstream:    %s\n", strings.Join(summary.Upstream, ", "))
+	fmt.Fprintf(&builder, "Downstream:  %s\n", strings.Join(summary.Downstream, ", "))
+	for _, link := range summary.Links {
+		fmt.Fprintf(&builder, "Link:        %s %s\n", link.Title, link.URL)
+	}
+	if summary.Docs != "" {
+		fmt.Fprintf(&builder, "\n%s\n", summary.Docs)
+	}
+	_, err := io.WriteString(w, builder.String())
+	return err
 }
 
-func (cmd *renderCommand) renderMarkdown(ctx context.Context, stdout io.Writer) subcommands.ExitStatus {
+// writeTaskIDs writes the IDs of the tasks which have any of the tags of -tags.
+func (cmd *tasksCommand) writeTaskIDs(w io.Writer, tasks []*Task) error {
+	if cmd.tags != "" {
+		tags := splitTags(cmd.tags)
+		tasks = lo.Filter(tasks, func(task *Task, _ int) bool {
+			return task.HasTag(tags...)
+		})
+	}
+	ids := taskIDs(tasks)
+	if cmd.format == "json" {
+		return writeJSON(w, ids)
+	}
 	var builder strings.Builder
-	builder.WriteString("```mermaid\n")
-	if status := cmd.renderMermaid(ctx, &builder); status != subcommands.ExitSuccess {
-		return status
+	for _, id := range ids {
+		builder.WriteString(id)
+		builder.WriteRune('\n')
 	}
-	builder.WriteString("```\n")
-	io.WriteString(stdout, builder.String())
-	return subcommands.ExitSuccess
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// splitTags splits the comma separated tags, spaces around the tags are ignored.
+func splitTags(s string) []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// loadDAGRunContext reads DAGRunContext from the file, or from the DAG run state store if the file is DAGRunReference.
+func loadDAGRunContext(ctx context.Context, dag *DAG, path string) (*DAGRunContext, error) {
+	var bs []byte
+	var err error
+	if path == "-" {
+		bs, err = io.ReadAll(os.Stdin)
+	} else {
+		bs, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isDAGRunReferencePayload(bs) {
+		return DecodeDAGRunContext(bs)
+	}
+	var ref DAGRunReference
+	if err := json.Unmarshal(bs, &ref); err != nil {
+		return nil, err
+	}
+	store := dag.DAGRunStateStore()
+	if store == nil {
+		return nil, fmt.Errorf("`%s` is the reference of dag run `%s`, the dag run state store is required to load it", path, ref.DAGRunID)
+	}
+	dagRunCtx, _, err := store.LoadDAGRunContext(ctx, ref.DAGRunID)
+	return dagRunCtx, err
 }
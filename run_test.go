@@ -0,0 +1,116 @@
+package lambdag_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+	done := make(chan []byte)
+	go func() {
+		bs, _ := io.ReadAll(r)
+		done <- bs
+	}()
+	fn()
+	require.NoError(t, w.Close())
+	return string(<-done)
+}
+
+func TestRunTasksCommand(t *testing.T) {
+	dag, err := lambdag.NewDAG("TasksDAG")
+	require.NoError(t, err)
+	handler := lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return nil, nil
+	})
+	// task1 ─> task2 ─> task3
+	task1, err := dag.NewTask("task1", handler, lambdag.WithTaskOwner("data-team"), lambdag.WithTaskTags("etl"))
+	require.NoError(t, err)
+	task2, err := dag.NewTask("task2", handler, lambdag.WithTaskDescription("Transform events"))
+	require.NoError(t, err)
+	task3, err := dag.NewTask("task3", handler)
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2))
+	require.NoError(t, task2.SetDownstream(task3))
+
+	cases := []struct {
+		args      []string
+		expected  string
+		expectErr string
+	}{
+		{
+			args:     []string{"tasks", "upstream", "task3"},
+			expected: "task2\n",
+		},
+		{
+			args:     []string{"tasks", "-recursive", "upstream", "task3"},
+			expected: "task2\ntask1\n",
+		},
+		{
+			args:     []string{"tasks", "-format", "json", "-recursive", "downstream", "task1"},
+			expected: "[\n  \"task2\",\n  \"task3\"\n]\n",
+		},
+		{
+			args:     []string{"tasks", "show", "task2"},
+			expected: "Task:        task2\nDescription: Transform events\nUpstream:    task1\nDownstream:  task3\n",
+		},
+		{
+			args:     []string{"tasks", "-format", "json", "-tags", "etl", "list"},
+			expected: "[\n  {\n    \"TaskId\": \"task1\",\n    \"Owner\": \"data-team\",\n    \"Tags\": [\n      \"etl\"\n    ],\n    \"Upstream\": [],\n    \"Downstream\": [\n      \"task2\"\n    ]\n  }\n]\n",
+		},
+		{
+			args:     []string{"tasks", "-recursive", "-tags", "etl", "upstream", "task3"},
+			expected: "task1\n",
+		},
+		{
+			args:     []string{"tasks", "-tags", "etl", "downstream", "task1"},
+			expected: "",
+		},
+		{
+			args:      []string{"tasks", "-tags", "etl", "show", "task1"},
+			expectErr: "usage error",
+		},
+		{
+			args:      []string{"tasks", "show", "unknown"},
+			expectErr: "execute failed",
+		},
+		{
+			args:      []string{"tasks", "upstream"},
+			expectErr: "usage error",
+		},
+		{
+			args:      []string{"tasks", "sideways", "task1"},
+			expectErr: "usage error",
+		},
+	}
+	for _, c := range cases {
+		stdout := captureStdout(t, func() {
+			err := lambdag.Run(c.args, dag)
+			if c.expectErr != "" {
+				require.EqualError(t, err, c.expectErr, "args: %v", c.args)
+			} else {
+				require.NoError(t, err, "args: %v", c.args)
+			}
+		})
+		require.EqualValues(t, c.expected, stdout, "args: %v", c.args)
+	}
+
+	stdout := captureStdout(t, func() {
+		require.NoError(t, lambdag.Run([]string{"tasks", "list"}, dag))
+	})
+	require.True(t, strings.HasPrefix(stdout, "TASK   UPSTREAM  OWNER      TAGS  DESCRIPTION\n"), stdout)
+	require.Contains(t, stdout, "task2  task1")
+}
@@ -0,0 +1,105 @@
+package lambdag
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DAGRunContextSchemaVersion is the current schema version of DAGRunContext.
+// Version 0 is the schema before SchemaVersion field was introduced.
+// The version is incremented when the shape of the released DAGRunContext changes.
+const DAGRunContextSchemaVersion = 1
+
+// dagRunContextMigration upgrades the DAGRunContext JSON object from a version to the next version.
+type dagRunContextMigration func(obj map[string]json.RawMessage) (map[string]json.RawMessage, error)
+
+// dagRunContextMigrations is the registry of migrations, keyed by the source version.
+// When DAGRunContextSchemaVersion is incremented, the migration from the previous version must be registered.
+var dagRunContextMigrations = map[int]dagRunContextMigration{
+	0: migrateTaskAttempts,
+}
+
+// migrateTaskAttempts upgrades v0 to v1.
+// v1 added the optional fields only, and TaskAttempts is derived from v0: the finished tasks are counted as attempted once.
+func migrateTaskAttempts(obj map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	if _, ok := obj["TaskAttempts"]; ok {
+		return obj, nil
+	}
+	var responses map[string]json.RawMessage
+	if raw, ok := obj["TaskResponses"]; ok {
+		if err := json.Unmarshal(raw, &responses); err != nil {
+			return nil, fmt.Errorf("TaskResponses: %w", err)
+		}
+	}
+	if len(responses) == 0 {
+		return obj, nil
+	}
+	attempts := make(map[string]int, len(responses))
+	for taskID := range responses {
+		attempts[taskID] = 1
+	}
+	raw, err := json.Marshal(attempts)
+	if err != nil {
+		return nil, err
+	}
+	obj["TaskAttempts"] = raw
+	return obj, nil
+}
+
+type UnsupportedSchemaVersionError struct {
+	SchemaVersion int
+}
+
+func (err *UnsupportedSchemaVersionError) Error() string {
+	return fmt.Sprintf("DAGRunContext schema version %d is not supported: supported up to version %d", err.SchemaVersion, DAGRunContextSchemaVersion)
+}
+
+// DecodeDAGRunContext decodes the DAGRunContext JSON of any released schema version,
+// and upgrades it to the current schema version.
+func DecodeDAGRunContext(payload []byte) (*DAGRunContext, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &obj); err != nil {
+		return nil, err
+	}
+	version := 0
+	if raw, ok := obj["SchemaVersion"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, fmt.Errorf("SchemaVersion: %w", err)
+		}
+	}
+	if version > DAGRunContextSchemaVersion {
+		return nil, &UnsupportedSchemaVersionError{SchemaVersion: version}
+	}
+	for ; version < DAGRunContextSchemaVersion; version++ {
+		migration, ok := dagRunContextMigrations[version]
+		if !ok {
+			return nil, fmt.Errorf("migration from DAGRunContext schema version %d is not registered", version)
+		}
+		var err error
+		obj, err = migration(obj)
+		if err != nil {
+			return nil, fmt.Errorf("migrate DAGRunContext schema version %d: %w", version, err)
+		}
+	}
+	migrated, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var dagRunCtx DAGRunContext
+	if err := json.Unmarshal(migrated, &dagRunCtx); err != nil {
+		return nil, err
+	}
+	dagRunCtx.SchemaVersion = DAGRunContextSchemaVersion
+	return &dagRunCtx, nil
+}
+
+// isDAGRunContextPayload reports whether the payload is DAGRunContext (or DAGRunReference), not a new DAG run config.
+func isDAGRunContextPayload(payload []byte) bool {
+	var v struct {
+		DAGRunID string `json:"DAGRunId"`
+	}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return false
+	}
+	return v.DAGRunID != ""
+}
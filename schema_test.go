@@ -0,0 +1,103 @@
+package lambdag_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeDAGRunContextReleasedVersions(t *testing.T) {
+	base := lambdag.DAGRunContext{
+		SchemaVersion: lambdag.DAGRunContextSchemaVersion,
+		DAGRunID:      "4c3e1c3a-8d2e-4a8b-9a55-0e6c3f1b2a10",
+		DAGRunStartAt: time.Date(2022, 06, 19, 9, 0, 0, 0, time.UTC),
+		DAGRunConfig:  json.RawMessage(`{"Comment": "input your DAG run config here"}`),
+		TaskResponses: map[string]json.RawMessage{
+			"task1": json.RawMessage(`"task1 success"`),
+		},
+		LambdaCallCount: 1,
+		Continue:        true,
+	}
+	// the finished tasks of v0 are counted as attempted once by the migration.
+	base.TaskAttempts = map[string]int{"task1": 1}
+	v1 := base
+	v1.DAGFingerprint = "d226292ec8f62c8dbcce8fa44aa448a5efad153474627b5eafb006fdc09d349b"
+	v1.Signature = "c2lnbmF0dXJl"
+	v1.TaskAttempts = map[string]int{"task1": 1, "task2": 2}
+	v1.TaskCallbacksFired = map[string][]string{"task1": {"success"}}
+	v1.TraceContext = map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	v1.TaskInstances = []lambdag.TaskInstance{
+		{
+			TaskID:          "task1",
+			Attempt:         1,
+			LambdaCallCount: 1,
+			StartAt:         time.Date(2022, 06, 19, 9, 0, 0, 0, time.UTC),
+			EndAt:           time.Date(2022, 06, 19, 9, 0, 1, 0, time.UTC),
+			DurationMillis:  1000,
+			Outcome:         "success",
+		},
+	}
+	v1.TaskInstancesDropped = 2
+	retryReferenceVersion := int64(3)
+	v1.RetryReferenceVersion = &retryReferenceVersion
+	cases := map[int]lambdag.DAGRunContext{
+		0: base,
+		1: v1,
+	}
+	require.Len(t, cases, lambdag.DAGRunContextSchemaVersion+1, "add the fixture of the new schema version")
+	for version, expected := range cases {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			payload, err := os.ReadFile(fmt.Sprintf("testdata/dagruncontext/v%d.json", version))
+			require.NoError(t, err)
+			dagRunCtx, err := lambdag.DecodeDAGRunContext(payload)
+			require.NoError(t, err)
+			require.JSONEq(t, string(Must(json.Marshal(expected))), string(Must(json.Marshal(dagRunCtx))))
+
+			roundTrip, err := lambdag.DecodeDAGRunContext(Must(json.Marshal(dagRunCtx)))
+			require.NoError(t, err)
+			require.EqualValues(t, dagRunCtx, roundTrip)
+			if version == lambdag.DAGRunContextSchemaVersion {
+				require.JSONEq(t, string(payload), string(Must(json.Marshal(dagRunCtx))), "current version is encoded as it is")
+			}
+		})
+	}
+}
+
+func TestDecodeDAGRunContextUnsupportedVersion(t *testing.T) {
+	_, err := lambdag.DecodeDAGRunContext([]byte(fmt.Sprintf(`{"SchemaVersion":%d,"DAGRunId":"test"}`, lambdag.DAGRunContextSchemaVersion+1)))
+	var use *lambdag.UnsupportedSchemaVersionError
+	require.True(t, errors.As(err, &use))
+}
+
+func TestLambdaHandlerResumeOlderSchemaVersion(t *testing.T) {
+	dag, err := lambdag.NewDAG("SchemaDAG")
+	require.NoError(t, err)
+	task1, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task1 success", nil
+	}))
+	require.NoError(t, err)
+	task2, err := dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task2 success", nil
+	}))
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2))
+
+	payload, err := os.ReadFile("testdata/dagruncontext/v0.json")
+	require.NoError(t, err)
+	dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), payload)
+	require.EqualValues(t, lambdag.DAGRunContextSchemaVersion, dagRunCtx.SchemaVersion)
+	require.EqualValues(t, `"task2 success"`, string(dagRunCtx.TaskResponses["task2"]))
+
+	_, err = lambdag.NewLambdaHandler(dag).Invoke(context.Background(), []byte(`{"SchemaVersion":999,"DAGRunId":"test"}`))
+	var ive messages.InvokeResponse_Error
+	require.True(t, errors.As(err, &ive))
+	require.EqualValues(t, "LambDAG.UnsupportedSchemaVersion", ive.Type)
+}
@@ -0,0 +1,117 @@
+package lambdag
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SecretProvider provides the secret for signing DAGRunContext.
+type SecretProvider interface {
+	Secret(ctx context.Context) ([]byte, error)
+}
+
+type SecretProviderFunc func(ctx context.Context) ([]byte, error)
+
+func (f SecretProviderFunc) Secret(ctx context.Context) ([]byte, error) {
+	return f(ctx)
+}
+
+func NewStaticSecretProvider(secret []byte) SecretProvider {
+	return SecretProviderFunc(func(_ context.Context) ([]byte, error) {
+		return secret, nil
+	})
+}
+
+// WithDAGRunContextSigning signs DAGRunContext with HMAC-SHA256 on every response of LambdaHandler,
+// and verifies the signature of the incoming DAGRunContext.
+func WithDAGRunContextSigning(sp SecretProvider) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		if sp == nil {
+			return errors.New("secret provider is nil")
+		}
+		opts.secretProvider = sp
+		return nil
+	}
+}
+
+type DAGRunContextSignatureError struct {
+	DAGRunID string
+	Reason   string
+}
+
+func (err *DAGRunContextSignatureError) Error() string {
+	return fmt.Sprintf("DAGRunContext signature verification failed: DAGRunId %s: %s", err.DAGRunID, err.Reason)
+}
+
+const signatureFieldName = "Signature"
+
+// canonicalizeDAGRunContext returns the JSON without the signature field,
+// whose object keys are sorted, so that the signature does not depend on re-serialization by StepFunctions.
+func canonicalizeDAGRunContext(payload []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var obj map[string]interface{}
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+	delete(obj, signatureFieldName)
+	return json.Marshal(obj)
+}
+
+func computeSignature(secret []byte, payload []byte) (string, error) {
+	canonical, err := canonicalizeDAGRunContext(payload)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(canonical)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (dag *DAG) signDAGRunContext(ctx context.Context, dagRunCtx *DAGRunContext) error {
+	dagRunCtx.Signature = ""
+	if dag.opts.secretProvider == nil {
+		return nil
+	}
+	secret, err := dag.opts.secretProvider.Secret(ctx)
+	if err != nil {
+		return fmt.Errorf("get secret: %w", err)
+	}
+	payload, err := json.Marshal(dagRunCtx)
+	if err != nil {
+		return err
+	}
+	signature, err := computeSignature(secret, payload)
+	if err != nil {
+		return err
+	}
+	dagRunCtx.Signature = signature
+	return nil
+}
+
+func (dag *DAG) verifyDAGRunContext(ctx context.Context, dagRunCtx *DAGRunContext, payload []byte) error {
+	if dag.opts.secretProvider == nil {
+		return nil
+	}
+	if dagRunCtx.Signature == "" {
+		return &DAGRunContextSignatureError{DAGRunID: dagRunCtx.DAGRunID, Reason: "signature is missing"}
+	}
+	secret, err := dag.opts.secretProvider.Secret(ctx)
+	if err != nil {
+		return fmt.Errorf("get secret: %w", err)
+	}
+	expected, err := computeSignature(secret, payload)
+	if err != nil {
+		return &DAGRunContextSignatureError{DAGRunID: dagRunCtx.DAGRunID, Reason: err.Error()}
+	}
+	if !hmac.Equal([]byte(expected), []byte(dagRunCtx.Signature)) {
+		return &DAGRunContextSignatureError{DAGRunID: dagRunCtx.DAGRunID, Reason: "signature mismatch"}
+	}
+	return nil
+}
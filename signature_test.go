@@ -0,0 +1,76 @@
+package lambdag_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAGRunContextSigning(t *testing.T) {
+	dag, err := lambdag.NewDAG(
+		"SigningDAG",
+		lambdag.WithDAGRunContextSigning(lambdag.NewStaticSecretProvider([]byte("secret"))),
+	)
+	require.NoError(t, err)
+	task1, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return map[string]interface{}{"Number": 1.5, "Name": "task1"}, nil
+	}))
+	require.NoError(t, err)
+	task2, err := dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task2 success", nil
+	}))
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2))
+
+	handler := lambdag.NewLambdaHandler(dag)
+	ctx := context.Background()
+	resp, err := handler.Invoke(ctx, []byte(`{"Comment":"signing"}`))
+	require.NoError(t, err)
+	var dagRunCtx lambdag.DAGRunContext
+	require.NoError(t, json.Unmarshal(resp, &dagRunCtx))
+	require.NotEmpty(t, dagRunCtx.Signature)
+
+	var reformatted bytes.Buffer
+	require.NoError(t, json.Indent(&reformatted, resp, "", "  "))
+	_, err = handler.Invoke(ctx, reformatted.Bytes())
+	require.NoError(t, err, "signature does not depend on formatting")
+
+	cases := []struct {
+		name    string
+		mutate  func(*lambdag.DAGRunContext)
+		message string
+	}{
+		{
+			name: "forged task responses",
+			mutate: func(dagRunCtx *lambdag.DAGRunContext) {
+				dagRunCtx.TaskResponses["task2"] = json.RawMessage(`"skipped"`)
+			},
+			message: "signature mismatch",
+		},
+		{
+			name: "missing signature",
+			mutate: func(dagRunCtx *lambdag.DAGRunContext) {
+				dagRunCtx.Signature = ""
+			},
+			message: "signature is missing",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var forged lambdag.DAGRunContext
+			require.NoError(t, json.Unmarshal(resp, &forged))
+			c.mutate(&forged)
+			_, err := handler.Invoke(ctx, Must(json.Marshal(forged)))
+			var ive messages.InvokeResponse_Error
+			require.True(t, errors.As(err, &ive))
+			require.EqualValues(t, "LambDAG.SignatureInvalid", ive.Type)
+			require.Contains(t, ive.Message, c.message)
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package lambdag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DAGRunStateStore persists DAGRunContext outside of the Lambda payload.
+// SaveDAGRunContext must fail with DAGRunStateConflictError when the stored version is not expectedVersion.
+// Version 0 means that the DAG run has not been saved yet.
+type DAGRunStateStore interface {
+	LoadDAGRunContext(ctx context.Context, dagRunID string) (*DAGRunContext, int64, error)
+	SaveDAGRunContext(ctx context.Context, dagRunCtx *DAGRunContext, expectedVersion int64) (int64, error)
+}
+
+func WithDAGRunStateStore(store DAGRunStateStore) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		if store == nil {
+			return errors.New("dag run state store is nil")
+		}
+		opts.dagRunStateStore = store
+		return nil
+	}
+}
+
+// DAGRunReference is the Lambda payload passed through StepFunctions when DAGRunStateStore is used.
+type DAGRunReference struct {
+	DAGRunID       string `json:"DAGRunId"`
+	Version        int64  `json:"Version"`
+	Continue       bool   `json:"Continue"`
+	IsCircuitBreak bool   `json:"IsCircuitBreak"`
+}
+
+// isDAGRunReferencePayload reports whether the payload is DAGRunReference, not DAGRunContext.
+func isDAGRunReferencePayload(payload []byte) bool {
+	var v map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return false
+	}
+	_, hasVersion := v["Version"]
+	_, hasSchemaVersion := v["SchemaVersion"]
+	_, hasLambdaCallCount := v["LambdaCallCount"]
+	return hasVersion && !hasSchemaVersion && !hasLambdaCallCount
+}
+
+type DAGRunStateNotFoundError struct {
+	DAGRunID string
+}
+
+func (err *DAGRunStateNotFoundError) Error() string {
+	return fmt.Sprintf("dag run state `%s` not found", err.DAGRunID)
+}
+
+type DAGRunStateConflictError struct {
+	DAGRunID        string
+	ExpectedVersion int64
+	ActualVersion   int64
+}
+
+func (err *DAGRunStateConflictError) Error() string {
+	return fmt.Sprintf("dag run state `%s` version conflict: expected %d, actual %d", err.DAGRunID, err.ExpectedVersion, err.ActualVersion)
+}
+
+// KeyValueStore is a versioned key-value storage.
+// Get returns version 0 and found false when the key does not exist.
+// CompareAndSwap writes the value only if the current version equals expectedVersion.
+type KeyValueStore interface {
+	Get(ctx context.Context, key string) (value []byte, version int64, found bool, err error)
+	CompareAndSwap(ctx context.Context, key string, value []byte, expectedVersion int64) (newVersion int64, swapped bool, err error)
+}
+
+type KeyValueDAGRunStateStore struct {
+	kv     KeyValueStore
+	prefix string
+}
+
+func NewKeyValueDAGRunStateStore(kv KeyValueStore, prefix string) *KeyValueDAGRunStateStore {
+	return &KeyValueDAGRunStateStore{
+		kv:     kv,
+		prefix: prefix,
+	}
+}
+
+func NewFileDAGRunStateStore(dir string) (*KeyValueDAGRunStateStore, error) {
+	kv, err := NewFileKeyValueStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyValueDAGRunStateStore(kv, ""), nil
+}
+
+func (s *KeyValueDAGRunStateStore) LoadDAGRunContext(ctx context.Context, dagRunID string) (*DAGRunContext, int64, error) {
+	value, version, found, err := s.kv.Get(ctx, s.prefix+dagRunID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !found {
+		return nil, 0, &DAGRunStateNotFoundError{DAGRunID: dagRunID}
+	}
+	dagRunCtx, err := DecodeDAGRunContext(value)
+	if err != nil {
+		return nil, 0, err
+	}
+	return dagRunCtx, version, nil
+}
+
+func (s *KeyValueDAGRunStateStore) SaveDAGRunContext(ctx context.Context, dagRunCtx *DAGRunContext, expectedVersion int64) (int64, error) {
+	value, err := json.Marshal(dagRunCtx)
+	if err != nil {
+		return 0, err
+	}
+	key := s.prefix + dagRunCtx.DAGRunID
+	newVersion, swapped, err := s.kv.CompareAndSwap(ctx, key, value, expectedVersion)
+	if err != nil {
+		return 0, err
+	}
+	if !swapped {
+		_, actualVersion, _, err := s.kv.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		return 0, &DAGRunStateConflictError{
+			DAGRunID:        dagRunCtx.DAGRunID,
+			ExpectedVersion: expectedVersion,
+			ActualVersion:   actualVersion,
+		}
+	}
+	return newVersion, nil
+}
+
+// FileKeyValueStore is a KeyValueStore on the local filesystem, for local development.
+// CompareAndSwap is atomic only within a single process.
+type FileKeyValueStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+type keyValueEntry struct {
+	Version int64           `json:"Version"`
+	Value   json.RawMessage `json:"Value"`
+}
+
+func NewFileKeyValueStore(dir string) (*FileKeyValueStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileKeyValueStore{dir: dir}, nil
+}
+
+// filename returns the file name of the key, the key must not escape the directory.
+// Keys contain DAG run IDs taken from the payload of the invocation.
+func (s *FileKeyValueStore) filename(key string) (string, error) {
+	if key == "" || strings.ContainsRune(key, '\\') || filepath.IsAbs(filepath.FromSlash(key)) || path.Clean("/"+key) != "/"+key {
+		return "", fmt.Errorf("invalid key `%s`", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)+".json"), nil
+}
+
+func (s *FileKeyValueStore) Get(_ context.Context, key string) ([]byte, int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key)
+}
+
+func (s *FileKeyValueStore) get(key string) ([]byte, int64, bool, error) {
+	name, err := s.filename(key)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	bs, err := os.ReadFile(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, false, nil
+		}
+		return nil, 0, false, err
+	}
+	var entry keyValueEntry
+	if err := json.Unmarshal(bs, &entry); err != nil {
+		return nil, 0, false, err
+	}
+	return entry.Value, entry.Version, true, nil
+}
+
+func (s *FileKeyValueStore) CompareAndSwap(_ context.Context, key string, value []byte, expectedVersion int64) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, version, _, err := s.get(key)
+	if err != nil {
+		return 0, false, err
+	}
+	if version != expectedVersion {
+		return version, false, nil
+	}
+	bs, err := json.Marshal(keyValueEntry{
+		Version: version + 1,
+		Value:   value,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	name, err := s.filename(key)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return 0, false, err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0644); err != nil {
+		return 0, false, err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return 0, false, err
+	}
+	return version + 1, true, nil
+}
+
+type InMemoryKeyValueStore struct {
+	mu      sync.Mutex
+	entries map[string]keyValueEntry
+}
+
+func NewInMemoryKeyValueStore() *InMemoryKeyValueStore {
+	return &InMemoryKeyValueStore{
+		entries: make(map[string]keyValueEntry),
+	}
+}
+
+func (s *InMemoryKeyValueStore) Get(_ context.Context, key string) ([]byte, int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, 0, false, nil
+	}
+	value := make([]byte, len(entry.Value))
+	copy(value, entry.Value)
+	return value, entry.Version, true, nil
+}
+
+func (s *InMemoryKeyValueStore) CompareAndSwap(_ context.Context, key string, value []byte, expectedVersion int64) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.entries[key]
+	if entry.Version != expectedVersion {
+		return entry.Version, false, nil
+	}
+	stored := make([]byte, len(value))
+	copy(stored, value)
+	s.entries[key] = keyValueEntry{
+		Version: entry.Version + 1,
+		Value:   stored,
+	}
+	return entry.Version + 1, true, nil
+}
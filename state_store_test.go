@@ -0,0 +1,164 @@
+package lambdag_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLambdaHandlerWithDAGRunStateStore(t *testing.T) {
+	kv := lambdag.NewInMemoryKeyValueStore()
+	store := lambdag.NewKeyValueDAGRunStateStore(kv, "runs/")
+	dag, err := lambdag.NewDAG(
+		"StateStoreDAG",
+		lambdag.WithDAGRunStateStore(store),
+	)
+	require.NoError(t, err)
+	task2Failed := false
+	task1, err := dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		return "task1 success", nil
+	}))
+	require.NoError(t, err)
+	task2, err := dag.NewTask("task2", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		if !task2Failed {
+			task2Failed = true
+			return nil, errors.New("task2 temporary error")
+		}
+		return string(tr.TaskResponses["task1"]), nil
+	}))
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2))
+
+	handler := lambdag.NewLambdaHandler(dag)
+	ctx := context.Background()
+	resp, err := handler.Invoke(ctx, []byte(`{"Comment":"state store"}`))
+	require.NoError(t, err)
+	var ref lambdag.DAGRunReference
+	require.NoError(t, json.Unmarshal(resp, &ref))
+	require.EqualValues(t, 1, ref.Version)
+	require.True(t, ref.Continue)
+	require.JSONEq(t, `{"DAGRunId":"`+ref.DAGRunID+`","Version":1,"Continue":true,"IsCircuitBreak":false}`, string(resp))
+
+	_, err = handler.Invoke(ctx, resp)
+	require.EqualError(t, err, "task2 temporary error")
+	dagRunCtx, version, err := store.LoadDAGRunContext(ctx, ref.DAGRunID)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, version, "state is saved even if task failed")
+	require.EqualValues(t, 2, dagRunCtx.LambdaCallCount)
+
+	resp, err = handler.Invoke(ctx, resp)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(resp, &ref))
+	require.EqualValues(t, 3, ref.Version)
+	require.False(t, ref.Continue)
+
+	dagRunCtx, _, err = store.LoadDAGRunContext(ctx, ref.DAGRunID)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Comment":"state store"}`, string(dagRunCtx.DAGRunConfig))
+	require.EqualValues(t, map[string]json.RawMessage{
+		"task1": json.RawMessage(`"task1 success"`),
+		"task2": json.RawMessage(`"\"task1 success\""`),
+	}, dagRunCtx.TaskResponses)
+
+	stale := []byte(`{"DAGRunId":"` + ref.DAGRunID + `","Version":1,"Continue":true,"IsCircuitBreak":false}`)
+	_, err = handler.Invoke(ctx, stale)
+	var ive messages.InvokeResponse_Error
+	require.True(t, errors.As(err, &ive))
+	require.EqualValues(t, "LambDAG.StateConflict", ive.Type)
+	require.EqualValues(t, "dag run state `"+ref.DAGRunID+"` does not match the payload: stored version 3, payload version 1", ive.Message)
+}
+
+func TestLambdaHandlerWithDAGRunStateStoreRetry(t *testing.T) {
+	store := lambdag.NewKeyValueDAGRunStateStore(lambdag.NewInMemoryKeyValueStore(), "runs/")
+	dag, err := lambdag.NewDAG("StateStoreDAG", lambdag.WithDAGRunStateStore(store))
+	require.NoError(t, err)
+	attempts := make([]int, 0)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		attempts = append(attempts, tr.Attempt)
+		if tr.Attempt < 3 {
+			return nil, lambdag.WrapTaskRetryable(errors.New("try again"))
+		}
+		return "task1 success", nil
+	}))
+	require.NoError(t, err)
+
+	handler := lambdag.NewLambdaHandler(dag)
+	ctx := context.Background()
+	// the first invocation continues with the reference, the retry of it would start another DAG run.
+	resp, err := handler.Invoke(ctx, []byte(`{}`))
+	require.NoError(t, err)
+	var ref lambdag.DAGRunReference
+	require.NoError(t, json.Unmarshal(resp, &ref))
+	require.True(t, ref.Continue)
+
+	// StepFunctions retries the failed invocation with the same reference.
+	_, err = handler.Invoke(ctx, resp)
+	var ive messages.InvokeResponse_Error
+	require.True(t, errors.As(err, &ive))
+	require.EqualValues(t, "LambDAG.Retryable", ive.Type)
+	resp, err = handler.Invoke(ctx, resp)
+	require.NoError(t, err)
+	var last lambdag.DAGRunReference
+	require.NoError(t, json.Unmarshal(resp, &last))
+	require.EqualValues(t, ref.DAGRunID, last.DAGRunID)
+	require.False(t, last.Continue)
+	require.EqualValues(t, []int{1, 2, 3}, attempts)
+}
+
+func TestFileDAGRunStateStoreConflict(t *testing.T) {
+	store, err := lambdag.NewFileDAGRunStateStore(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, _, err = store.LoadDAGRunContext(ctx, "test-run")
+	var nfe *lambdag.DAGRunStateNotFoundError
+	require.True(t, errors.As(err, &nfe))
+
+	dagRunCtx := &lambdag.DAGRunContext{
+		DAGRunID:      "test-run",
+		TaskResponses: map[string]json.RawMessage{},
+	}
+	version, err := store.SaveDAGRunContext(ctx, dagRunCtx, 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, version)
+	dagRunCtx.LambdaCallCount = 1
+	version, err = store.SaveDAGRunContext(ctx, dagRunCtx, 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, version)
+
+	_, err = store.SaveDAGRunContext(ctx, dagRunCtx, 1)
+	var ce *lambdag.DAGRunStateConflictError
+	require.True(t, errors.As(err, &ce))
+	require.EqualValues(t, 1, ce.ExpectedVersion)
+	require.EqualValues(t, 2, ce.ActualVersion)
+
+	loaded, version, err := store.LoadDAGRunContext(ctx, "test-run")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, version)
+	require.EqualValues(t, 1, loaded.LambdaCallCount)
+}
+
+func TestFileKeyValueStoreInvalidKey(t *testing.T) {
+	dir := t.TempDir()
+	kv, err := lambdag.NewFileKeyValueStore(filepath.Join(dir, "store"))
+	require.NoError(t, err)
+	ctx := context.Background()
+	for _, key := range []string{"", "../escaped", "runs/../../escaped", "/escaped", `..\escaped`, "runs//id"} {
+		_, _, err := kv.CompareAndSwap(ctx, key, []byte(`{}`), 0)
+		require.EqualError(t, err, "invalid key `"+key+"`", key)
+		_, _, _, err = kv.Get(ctx, key)
+		require.EqualError(t, err, "invalid key `"+key+"`", key)
+	}
+	_, err = os.Stat(filepath.Join(dir, "escaped.json"))
+	require.True(t, os.IsNotExist(err))
+
+	_, swapped, err := kv.CompareAndSwap(ctx, "runs/id", []byte(`{}`), 0)
+	require.NoError(t, err)
+	require.True(t, swapped)
+}
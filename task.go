@@ -6,6 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"time"
+
+	"github.com/Songmu/flextime"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Task struct {
@@ -16,15 +23,52 @@ type Task struct {
 }
 
 type TaskOptions struct {
-	newLoggerFunc func(context.Context, *DAGRunContext) (*log.Logger, error)
-	newLockerFunc func(context.Context, *DAGRunContext) (LockerWithError, error)
+	newLoggerFunc  func(context.Context, *DAGRunContext) (*log.Logger, error)
+	newSloggerFunc func(context.Context, *DAGRunContext) (*slog.Logger, error)
+	newLockerFunc  func(context.Context, *DAGRunContext) (LockerWithError, error)
+	responseCodec  ResponseCodec
+	// responseSizeLimit is set by WithTaskResponseSizeLimit, 0 means no limit.
+	responseSizeLimit int
+	middlewares       []TaskMiddleware
+	onSuccess         []TaskCallback
+	onFailure         []TaskCallback
+	onRetry           []TaskCallback
+	description       string
+	owner             string
+	tags              []string
+	docs              string
+	links             []TaskLink
 }
 
 type TaskRequest struct {
 	DAGRunID      string
+	DAGRunStartAt time.Time
 	DAGRunConfig  json.RawMessage
+	TaskID        string
+	// Attempt is the number of times the task has been executed in the DAG run, starting from 1.
+	// Attempts are counted in DAGRunContext, the retry of the invocation failed with LambDAG.Retryable
+	// resends the previous payload, so the attempt is not carried across the retry unless DAGRunStateStore is used.
+	Attempt int
+	// TaskResponses is the snapshot of the responses of the ancestor tasks.
 	TaskResponses map[string]json.RawMessage
+	// LambdaContext is the context of the Lambda invocation, nil if not invoked by Lambda.
+	LambdaContext *lambdacontext.LambdaContext
 	Logger        *log.Logger
+	// Slogger is the structured logger with dag_id, dag_run_id, task_id, attempt and lambda_call_count attributes,
+	// and task_owner and task_tags if set.
+	Slogger *slog.Logger
+
+	dag      *DAG
+	deadline time.Time
+}
+
+// RemainingTime returns the remaining time until the deadline of the invocation.
+// ok is false if the invocation has no deadline.
+func (req *TaskRequest) RemainingTime() (remaining time.Duration, ok bool) {
+	if req.deadline.IsZero() {
+		return 0, false
+	}
+	return flextime.Until(req.deadline), true
 }
 
 type TaskHandler interface {
@@ -69,15 +113,23 @@ func (task *Task) ID() string {
 	return task.id
 }
 
+// TaskHandler returns the handler wrapped with the DAG and task middlewares.
 func (task *Task) TaskHandler() TaskHandler {
-	return task.handler
+	handler := applyTaskMiddlewares(task.handler, task.opts.middlewares...)
+	return applyTaskMiddlewares(handler, task.dag.opts.middlewares...)
 }
 
-func (task *Task) NewLogger(ctx context.Context, dagRunCtx *DAGRunContext) (*log.Logger, error) {
-	if task.opts.newLoggerFunc == nil {
-		return task.dag.NewLogger(ctx, dagRunCtx)
+func (task *Task) ResponseCodec() ResponseCodec {
+	if task.opts.responseCodec == nil {
+		return JSONCodec{}
 	}
-	return task.opts.newLoggerFunc(ctx, dagRunCtx)
+	return task.opts.responseCodec
+}
+
+// NewLogger returns *log.Logger of the task, the same as TaskRequest.Logger.
+func (task *Task) NewLogger(ctx context.Context, dagRunCtx *DAGRunContext) (*log.Logger, error) {
+	_, ll, err := task.newLoggers(ctx, dagRunCtx)
+	return ll, err
 }
 
 func (task *Task) NewLocker(ctx context.Context, dagRunCtx *DAGRunContext) (LockerWithError, error) {
@@ -114,33 +166,98 @@ func (task *Task) GoString() string {
 }
 
 func (task *Task) Execute(ctx context.Context, dagRunCtx *DAGRunContext) (json.RawMessage, error) {
-	l, err := task.NewLogger(ctx, dagRunCtx)
+	ctx, span := task.dag.tracer().Start(ctx, "lambdag.Task.Execute", trace.WithAttributes(
+		attribute.String("lambdag.dag_id", task.dag.ID()),
+		attribute.String("lambdag.dag_run_id", dagRunCtx.DAGRunID),
+		attribute.String("lambdag.task_id", task.ID()),
+		attribute.Int("lambdag.attempt", dagRunCtx.TaskAttempts[task.ID()]),
+	))
+	start := flextime.Now()
+	resp, err := task.execute(ctx, dagRunCtx)
+	task.putMetrics(ctx, dagRunCtx, start, err)
+	endSpan(span, err)
+	return resp, err
+}
+
+func (task *Task) execute(ctx context.Context, dagRunCtx *DAGRunContext) (json.RawMessage, error) {
+	l, ll, err := task.newLoggers(ctx, dagRunCtx)
 	if err != nil {
 		return nil, err
 	}
 	locker, err := task.NewLocker(ctx, dagRunCtx)
 	if err != nil {
-		l.Printf("[error] create locker : DAGRunId %s    Error %s", dagRunCtx.DAGRunID, err.Error())
+		l.Error("create locker", slog.Any("error", err))
 		return nil, err
 	}
 	lockGranted, err := locker.LockWithErr(ctx)
 	if err != nil {
-		l.Printf("[error] lock : DAGRunId %s    Error %s", dagRunCtx.DAGRunID, err.Error())
+		l.Error("lock", slog.Any("error", err))
 		return nil, err
 	}
 	if !lockGranted {
-		l.Printf("[warn] can not get lock : DAGRunId %s", dagRunCtx.DAGRunID)
+		l.Warn("can not get lock")
 		return nil, WrapTaskRetryable(errors.New("can not get lock"))
 	}
+	taskResponses, err := task.ancestorTaskResponses(ctx, dagRunCtx)
+	if err != nil {
+		l.Error("decode task responses", slog.Any("error", err))
+		return nil, err
+	}
 	req := &TaskRequest{
 		DAGRunID:      dagRunCtx.DAGRunID,
+		DAGRunStartAt: dagRunCtx.DAGRunStartAt,
 		DAGRunConfig:  dagRunCtx.DAGRunConfig,
-		TaskResponses: dagRunCtx.TaskResponses,
-		Logger:        l,
+		TaskID:        task.ID(),
+		Attempt:       dagRunCtx.TaskAttempts[task.ID()],
+		TaskResponses: taskResponses,
+		Logger:        ll,
+		Slogger:       l,
+		dag:           task.dag,
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		req.LambdaContext = lc
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.deadline = deadline
 	}
-	resp, err := task.TaskHandler().Invoke(ctx, req)
+	resp, err := task.invokeHandler(withTaskRequest(ctx, req), req)
 	if err != nil {
 		return nil, err
 	}
-	return json.Marshal(resp)
+	data, err := task.ResponseCodec().Encode(resp)
+	if err != nil {
+		return nil, err
+	}
+	if limit := task.opts.responseSizeLimit; limit > 0 && len(data) > limit {
+		return nil, &TaskResponseTooLargeError{
+			TaskID:     task.ID(),
+			Size:       len(data),
+			LimitBytes: limit,
+		}
+	}
+	return task.dag.encodeTaskResponse(ctx, dagRunCtx, task.ID(), data)
+}
+
+// ancestorTaskResponses returns the snapshot of the decoded responses of the ancestor tasks.
+// The snapshot does not share memory with dagRunCtx, so that the handler can not modify DAGRunContext.
+func (task *Task) ancestorTaskResponses(ctx context.Context, dagRunCtx *DAGRunContext) (map[string]json.RawMessage, error) {
+	ancestorResponses := make(map[string]json.RawMessage)
+	for _, ancestor := range task.dag.GetAncestorTasks(task.ID()) {
+		if resp, ok := dagRunCtx.TaskResponses[ancestor.ID()]; ok {
+			ancestorResponses[ancestor.ID()] = resp
+		}
+	}
+	decoded, err := task.dag.decodeTaskResponses(ctx, dagRunCtx.DAGRunID, ancestorResponses)
+	if err != nil {
+		return nil, err
+	}
+	for taskID, resp := range decoded {
+		decoded[taskID] = append(json.RawMessage(nil), resp...)
+	}
+	return decoded, nil
+}
+
+func (task *Task) invokeHandler(ctx context.Context, req *TaskRequest) (resp interface{}, err error) {
+	defer recoverTaskPanic(req, &resp, &err)
+	return task.TaskHandler().Invoke(ctx, req)
 }
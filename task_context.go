@@ -0,0 +1,53 @@
+package lambdag
+
+import (
+	"context"
+	"time"
+)
+
+type taskRequestContextKey struct{}
+
+func withTaskRequest(ctx context.Context, req *TaskRequest) context.Context {
+	return context.WithValue(ctx, taskRequestContextKey{}, req)
+}
+
+func taskRequestFromContext(ctx context.Context) (*TaskRequest, bool) {
+	req, ok := ctx.Value(taskRequestContextKey{}).(*TaskRequest)
+	return req, ok
+}
+
+// TaskIDFromContext returns the ID of the running task from the context passed to TaskHandler.
+func TaskIDFromContext(ctx context.Context) (string, bool) {
+	req, ok := taskRequestFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return req.TaskID, true
+}
+
+// DAGRunIDFromContext returns the DAG run ID from the context passed to TaskHandler.
+func DAGRunIDFromContext(ctx context.Context) (string, bool) {
+	req, ok := taskRequestFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return req.DAGRunID, true
+}
+
+// DAGRunStartAtFromContext returns the start time of the DAG run from the context passed to TaskHandler.
+func DAGRunStartAtFromContext(ctx context.Context) (time.Time, bool) {
+	req, ok := taskRequestFromContext(ctx)
+	if !ok {
+		return time.Time{}, false
+	}
+	return req.DAGRunStartAt, true
+}
+
+// TaskAttemptFromContext returns the attempt number of the running task from the context passed to TaskHandler.
+func TaskAttemptFromContext(ctx context.Context) (int, bool) {
+	req, ok := taskRequestFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	return req.Attempt, true
+}
@@ -0,0 +1,242 @@
+package lambdag
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+)
+
+func WithTaskResponseCompression(enabled bool) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		opts.taskResponseCompression = enabled
+		return nil
+	}
+}
+
+const (
+	taskResponseEnvelopeKey     = "LambDAGEnvelope"
+	taskResponseEnvelopeVersion = 1
+	compressionGzip             = "gzip"
+)
+
+// taskResponseEnvelope is stored in DAGRunContext.TaskResponses instead of the raw task response.
+// Envelopes are nested in the fixed order of the layers, Data holds the inner (compressed or encrypted) response.
+// A task response that itself looks like an envelope is stored in the Raw layer, so that it is not decoded as an envelope.
+type taskResponseEnvelope struct {
+	Version      int             `json:"Version"`
+	Ref          string          `json:"Ref,omitempty"`
+	Compression  string          `json:"Compression,omitempty"`
+	Encryption   string          `json:"Encryption,omitempty"`
+	EncryptedKey []byte          `json:"EncryptedKey,omitempty"`
+	Nonce        []byte          `json:"Nonce,omitempty"`
+	Data         []byte          `json:"Data,omitempty"`
+	Raw          json.RawMessage `json:"Raw,omitempty"`
+}
+
+// taskResponseLayer is the kind of the envelope, in the order of decoding.
+type taskResponseLayer int
+
+const (
+	taskResponseLayerRef taskResponseLayer = iota
+	taskResponseLayerEncryption
+	taskResponseLayerCompression
+	taskResponseLayerRaw
+)
+
+func (envelope *taskResponseEnvelope) layer() (taskResponseLayer, error) {
+	layers := make([]taskResponseLayer, 0, 1)
+	if envelope.Ref != "" {
+		layers = append(layers, taskResponseLayerRef)
+	}
+	if envelope.Encryption != "" {
+		layers = append(layers, taskResponseLayerEncryption)
+	}
+	if envelope.Compression != "" {
+		layers = append(layers, taskResponseLayerCompression)
+	}
+	if envelope.Raw != nil {
+		layers = append(layers, taskResponseLayerRaw)
+	}
+	if len(layers) != 1 {
+		return 0, errors.New("invalid task response envelope: exactly one layer is required")
+	}
+	return layers[0], nil
+}
+
+func wrapTaskResponseEnvelope(envelope *taskResponseEnvelope) (json.RawMessage, error) {
+	envelope.Version = taskResponseEnvelopeVersion
+	return json.Marshal(map[string]*taskResponseEnvelope{
+		taskResponseEnvelopeKey: envelope,
+	})
+}
+
+// isTaskResponseEnvelope reports whether data is shaped like an envelope, the object with the only envelope key.
+func isTaskResponseEnvelope(data json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("{")) || !bytes.Contains(trimmed, []byte(taskResponseEnvelopeKey)) {
+		return false
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &obj); err != nil || len(obj) != 1 {
+		return false
+	}
+	_, ok := obj[taskResponseEnvelopeKey]
+	return ok
+}
+
+// unwrapTaskResponseEnvelope decodes the envelope strictly, ok is false if data is not shaped like an envelope.
+// encodeTaskResponse never stores such a task response as it is, so the envelope shaped data must be a valid envelope.
+func unwrapTaskResponseEnvelope(data json.RawMessage) (envelope *taskResponseEnvelope, ok bool, err error) {
+	if !isTaskResponseEnvelope(data) {
+		return nil, false, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, false, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(obj[taskResponseEnvelopeKey]))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&envelope); err != nil {
+		return nil, false, fmt.Errorf("invalid task response envelope: %w", err)
+	}
+	if envelope == nil || envelope.Version != taskResponseEnvelopeVersion {
+		return nil, false, errors.New("invalid task response envelope: unsupported version")
+	}
+	return envelope, true, nil
+}
+
+// encodeTaskResponse converts the task response to the form stored in DAGRunContext.TaskResponses.
+// The response is compressed and encrypted first, and then put to the response store if it is still larger than the threshold.
+func (dag *DAG) encodeTaskResponse(ctx context.Context, dagRunCtx *DAGRunContext, taskID string, data json.RawMessage) (json.RawMessage, error) {
+	if isTaskResponseEnvelope(data) {
+		raw, err := wrapTaskResponseEnvelope(&taskResponseEnvelope{Raw: data})
+		if err != nil {
+			return nil, err
+		}
+		data = raw
+	}
+	if dag.opts.taskResponseCompression {
+		compressed, err := compressTaskResponse(data)
+		if err != nil {
+			return nil, fmt.Errorf("compress response: %w", err)
+		}
+		if len(compressed) < len(data) {
+			data = compressed
+		}
+	}
+	if dag.opts.keyProvider != nil {
+		encrypted, err := encryptTaskResponse(ctx, dag.opts.keyProvider, dagRunCtx.DAGRunID, taskID, data)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt response: %w", err)
+		}
+		data = encrypted
+	}
+	if dag.opts.responseStore == nil || len(data) <= dag.opts.responseStoreThreshold {
+		return data, nil
+	}
+	key := path.Join(dag.ID(), dagRunCtx.DAGRunID, taskID+".json")
+	ref, err := dag.opts.responseStore.PutResponse(ctx, key, data)
+	if err != nil {
+		return nil, fmt.Errorf("put response to store: %w", err)
+	}
+	return wrapTaskResponseEnvelope(&taskResponseEnvelope{Ref: ref})
+}
+
+func compressTaskResponse(data json.RawMessage) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return wrapTaskResponseEnvelope(&taskResponseEnvelope{
+		Compression: compressionGzip,
+		Data:        buf.Bytes(),
+	})
+}
+
+func decompressTaskResponse(envelope *taskResponseEnvelope) (json.RawMessage, error) {
+	if envelope.Compression != compressionGzip {
+		return nil, fmt.Errorf("unsupported compression `%s`", envelope.Compression)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(envelope.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// decodeTaskResponse unwraps the envelopes in the order of ref, encryption, compression and raw.
+// Each layer is unwrapped at most once, so that the crafted payload can not nest envelopes arbitrarily.
+// When the encryption is enabled, the response without the encryption layer is rejected.
+func (dag *DAG) decodeTaskResponse(ctx context.Context, dagRunID string, taskID string, data json.RawMessage) (json.RawMessage, error) {
+	next := taskResponseLayerRef
+	for {
+		envelope, ok, err := unwrapTaskResponseEnvelope(data)
+		if err != nil {
+			return nil, err
+		}
+		layer := taskResponseLayerRaw
+		if ok {
+			layer, err = envelope.layer()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if dag.opts.keyProvider != nil && next <= taskResponseLayerEncryption && layer > taskResponseLayerEncryption {
+			return nil, errors.New("response is not encrypted")
+		}
+		if !ok {
+			return data, nil
+		}
+		if layer < next {
+			return nil, errors.New("invalid task response envelope: unexpected layer order")
+		}
+		next = layer + 1
+		switch layer {
+		case taskResponseLayerRef:
+			if dag.opts.responseStore == nil {
+				return nil, fmt.Errorf("response store is not configured: can not resolve `%s`", envelope.Ref)
+			}
+			stored, err := dag.opts.responseStore.GetResponse(ctx, envelope.Ref)
+			if err != nil {
+				return nil, fmt.Errorf("get response from store: %w", err)
+			}
+			data = stored
+		case taskResponseLayerEncryption:
+			decrypted, err := decryptTaskResponse(ctx, dag.opts.keyProvider, dagRunID, taskID, envelope)
+			if err != nil {
+				return nil, fmt.Errorf("decrypt response: %w", err)
+			}
+			data = decrypted
+		case taskResponseLayerCompression:
+			decompressed, err := decompressTaskResponse(envelope)
+			if err != nil {
+				return nil, fmt.Errorf("decompress response: %w", err)
+			}
+			data = decompressed
+		case taskResponseLayerRaw:
+			return envelope.Raw, nil
+		}
+	}
+}
+
+func (dag *DAG) decodeTaskResponses(ctx context.Context, dagRunID string, responses map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	decoded := make(map[string]json.RawMessage, len(responses))
+	for taskID, data := range responses {
+		resp, err := dag.decodeTaskResponse(ctx, dagRunID, taskID, data)
+		if err != nil {
+			return nil, fmt.Errorf("task `%s` response: %w", taskID, err)
+		}
+		decoded[taskID] = resp
+	}
+	return decoded, nil
+}
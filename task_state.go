@@ -0,0 +1,57 @@
+package lambdag
+
+import "github.com/samber/lo"
+
+// TaskState is the status of the task in the DAG run.
+type TaskState string
+
+const (
+	TaskStateDone       TaskState = "done"
+	TaskStatePending    TaskState = "pending"
+	TaskStateExecutable TaskState = "executable"
+	TaskStateFailed     TaskState = "failed"
+	TaskStateSkipped    TaskState = "skipped"
+)
+
+// TaskStates returns the status of all tasks in the DAG run.
+// A task is failed if its last TaskInstance failed with not retryable error, and its descendants are skipped.
+func (dag *DAG) TaskStates(dagRunCtx *DAGRunContext) map[string]TaskState {
+	lastOutcomes := make(map[string]string)
+	for _, ti := range dagRunCtx.TaskInstances {
+		lastOutcomes[ti.TaskID] = ti.Outcome
+	}
+	finishedTaskIDs := lo.Keys(dagRunCtx.TaskResponses)
+	states := make(map[string]TaskState)
+	for _, task := range dag.GetAllTasks() {
+		switch {
+		case lo.Contains(finishedTaskIDs, task.ID()):
+			states[task.ID()] = TaskStateDone
+		case lastOutcomes[task.ID()] == "failure":
+			states[task.ID()] = TaskStateFailed
+		case dag.IsExecutableTask(task.ID(), finishedTaskIDs):
+			states[task.ID()] = TaskStateExecutable
+		default:
+			states[task.ID()] = TaskStatePending
+		}
+	}
+	for taskID, state := range states {
+		if state != TaskStateFailed {
+			continue
+		}
+		for _, descendant := range dag.GetDescendantTasks(taskID) {
+			if states[descendant.ID()] != TaskStateDone {
+				states[descendant.ID()] = TaskStateSkipped
+			}
+		}
+	}
+	return states
+}
+
+// taskStateColors is the fill color of the task nodes in the rendered DAG.
+var taskStateColors = map[TaskState]string{
+	TaskStateDone:       "#a3e4a3",
+	TaskStatePending:    "#ffffff",
+	TaskStateExecutable: "#9ecbff",
+	TaskStateFailed:     "#ff9e9e",
+	TaskStateSkipped:    "#d9d9d9",
+}
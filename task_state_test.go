@@ -0,0 +1,113 @@
+package lambdag_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+// invokeUntilFailure invokes the DAG with the state store until the invocation fails, and returns the last reference.
+func invokeUntilFailure(t *testing.T, dag *lambdag.DAG) []byte {
+	t.Helper()
+	handler := lambdag.NewLambdaHandler(dag)
+	payload := []byte(`{}`)
+	for i := 0; i < 10; i++ {
+		resp, err := handler.Invoke(context.Background(), payload)
+		if err != nil {
+			return payload
+		}
+		payload = resp
+	}
+	require.FailNow(t, "the DAG run did not fail")
+	return nil
+}
+
+func TestDAGTaskStates(t *testing.T) {
+	store := lambdag.NewKeyValueDAGRunStateStore(lambdag.NewInMemoryKeyValueStore(), "")
+	dag, err := lambdag.NewDAG("StateDAG", lambdag.WithNumOfTasksInSingleInvoke(2), lambdag.WithDAGRunStateStore(store))
+	require.NoError(t, err)
+	newHandler := func(err error) lambdag.TaskHandler {
+		return lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+			return tr.TaskID + " success", err
+		})
+	}
+	// start ─> ok ─> after_ok
+	//       └> ng ─> after_ng
+	//       └> waiting
+	start, err := dag.NewTask("start", newHandler(nil))
+	require.NoError(t, err)
+	ok, err := dag.NewTask("ok", newHandler(nil))
+	require.NoError(t, err)
+	ng, err := dag.NewTask("ng", newHandler(errors.New("ng error")))
+	require.NoError(t, err)
+	afterOK, err := dag.NewTask("after_ok", newHandler(nil))
+	require.NoError(t, err)
+	afterNG, err := dag.NewTask("after_ng", newHandler(nil))
+	require.NoError(t, err)
+	waiting, err := dag.NewTask("waiting", newHandler(nil))
+	require.NoError(t, err)
+	require.NoError(t, start.SetDownstream(ng, ok, waiting))
+	require.NoError(t, ok.SetDownstream(afterOK))
+	require.NoError(t, ng.SetDownstream(afterNG))
+
+	dagRunCtx := &lambdag.DAGRunContext{
+		DAGRunID:      "test-run",
+		TaskResponses: map[string]json.RawMessage{},
+	}
+	require.EqualValues(t, map[string]lambdag.TaskState{
+		"start":    lambdag.TaskStateExecutable,
+		"ok":       lambdag.TaskStatePending,
+		"ng":       lambdag.TaskStatePending,
+		"after_ok": lambdag.TaskStatePending,
+		"after_ng": lambdag.TaskStatePending,
+		"waiting":  lambdag.TaskStatePending,
+	}, dag.TaskStates(dagRunCtx))
+
+	// ng and ok are executed, waiting is not executed because of NumOfTasksInSingleInvoke.
+	// The state of the failed invocation is loaded from the store, not from the in-memory DAGRunContext.
+	ref := invokeUntilFailure(t, dag)
+	var dagRunRef lambdag.DAGRunReference
+	require.NoError(t, json.Unmarshal(ref, &dagRunRef))
+	dagRunCtx, _, err = store.LoadDAGRunContext(context.Background(), dagRunRef.DAGRunID)
+	require.NoError(t, err)
+	require.EqualValues(t, map[string]lambdag.TaskState{
+		"start":    lambdag.TaskStateDone,
+		"ok":       lambdag.TaskStateDone,
+		"ng":       lambdag.TaskStateFailed,
+		"after_ok": lambdag.TaskStateExecutable,
+		"after_ng": lambdag.TaskStateSkipped,
+		"waiting":  lambdag.TaskStateExecutable,
+	}, dag.TaskStates(dagRunCtx))
+
+	payload := filepath.Join(t.TempDir(), "payload.json")
+	require.NoError(t, os.WriteFile(payload, ref, 0644))
+	stdout := captureStdout(t, func() {
+		require.NoError(t, lambdag.Run([]string{"render", "-format", "mermaid", "-state", payload}, dag))
+	})
+	require.Contains(t, stdout, "class ng failed\n")
+	require.Contains(t, stdout, "class after_ng skipped\n")
+
+	t.Run("reference without state store", func(t *testing.T) {
+		handled := make([]string, 0)
+		dag := newChainDAG(t, []string{"task1", "task2"}, &handled)
+		stdout := captureStdout(t, func() {
+			require.Error(t, lambdag.Run([]string{"render", "-format", "mermaid", "-state", payload}, dag))
+		})
+		require.Empty(t, stdout)
+	})
+
+	t.Run("another DAG definition", func(t *testing.T) {
+		handled := make([]string, 0)
+		dag := newChainDAG(t, []string{"task1", "task2"}, &handled, lambdag.WithDAGRunStateStore(store))
+		stdout := captureStdout(t, func() {
+			require.Error(t, lambdag.Run([]string{"render", "-format", "mermaid", "-state", payload}, dag))
+		})
+		require.Empty(t, stdout)
+	})
+}
@@ -0,0 +1,112 @@
+package lambdag
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/mashiike/lambdag"
+
+// WithTracerProvider sets the OpenTelemetry TracerProvider, the global TracerProvider is used by default.
+// If the provider has ForceFlush method, it is called at the end of each Lambda invocation.
+func WithTracerProvider(tp trace.TracerProvider) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		if tp == nil {
+			return errors.New("tracer provider is nil")
+		}
+		opts.tracerProvider = tp
+		return nil
+	}
+}
+
+// WithTraceExporter sets the TracerProvider which exports spans to the exporter,
+// such as stdouttrace, otlptrace or tracetest.InMemoryExporter.
+// The TracerProvider is owned by the DAG, call DAG.Shutdown to shut it down.
+func WithTraceExporter(exporter sdktrace.SpanExporter) func(opts *DAGOptions) error {
+	return func(opts *DAGOptions) error {
+		if exporter == nil {
+			return errors.New("trace exporter is nil")
+		}
+		tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+		opts.tracerProvider = tp
+		opts.ownedTracerProvider = tp
+		return nil
+	}
+}
+
+// Shutdown shuts down the TracerProvider created by WithTraceExporter, and the exporter with it.
+// The TracerProvider set by WithTracerProvider is not shut down, it is owned by the caller.
+func (dag *DAG) Shutdown(ctx context.Context) error {
+	if dag.opts.ownedTracerProvider == nil {
+		return nil
+	}
+	return dag.opts.ownedTracerProvider.Shutdown(ctx)
+}
+
+func (dag *DAG) TracerProvider() trace.TracerProvider {
+	if dag.opts.tracerProvider == nil {
+		return otel.GetTracerProvider()
+	}
+	return dag.opts.tracerProvider
+}
+
+func (dag *DAG) tracer() trace.Tracer {
+	return dag.TracerProvider().Tracer(tracerName)
+}
+
+func (dag *DAG) flushTraces(ctx context.Context) error {
+	if flusher, ok := dag.TracerProvider().(interface {
+		ForceFlush(context.Context) error
+	}); ok {
+		return flusher.ForceFlush(ctx)
+	}
+	return nil
+}
+
+// startInvokeSpan starts the span of the Lambda invocation.
+// The span of the first invocation is persisted in DAGRunContext as the root of the DAG run.
+// The spans of the following invocations start after the root span has ended, so they are linked to the root span
+// instead of being its children.
+func (dag *DAG) startInvokeSpan(ctx context.Context, dagRunCtx *DAGRunContext) (context.Context, trace.Span) {
+	propagator := propagation.TraceContext{}
+	isRoot := len(dagRunCtx.TraceContext) == 0
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("lambdag.dag_id", dag.ID()),
+			attribute.String("lambdag.dag_run_id", dagRunCtx.DAGRunID),
+			attribute.Bool("lambdag.dag_run_root", isRoot),
+		),
+	}
+	if !isRoot {
+		rootCtx := propagator.Extract(context.Background(), propagation.MapCarrier(dagRunCtx.TraceContext))
+		if rootSpanCtx := trace.SpanContextFromContext(rootCtx); rootSpanCtx.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{
+				SpanContext: rootSpanCtx,
+				Attributes:  []attribute.KeyValue{attribute.String("lambdag.link", "dag_run_root")},
+			}))
+		}
+	}
+	ctx, span := dag.tracer().Start(ctx, "lambdag.LambdaHandler.Invoke", opts...)
+	if isRoot && span.SpanContext().IsValid() {
+		carrier := propagation.MapCarrier{}
+		propagator.Inject(ctx, carrier)
+		dagRunCtx.TraceContext = carrier
+	}
+	return ctx, span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
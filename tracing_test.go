@@ -0,0 +1,85 @@
+package lambdag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingAcrossInvocations(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	handled := make([]string, 0)
+	dag := newChainDAG(t, []string{"task1", "task2", "task3"}, &handled, lambdag.WithTraceExporter(exporter))
+	dagRunCtx := invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+	require.NotEmpty(t, dagRunCtx.TraceContext["traceparent"])
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3+3+3)
+	var root tracetest.SpanStub
+	invokeSpans := make([]tracetest.SpanStub, 0)
+	taskIDs := make([]string, 0)
+	for _, span := range spans {
+		switch span.Name {
+		case "lambdag.LambdaHandler.Invoke":
+			invokeSpans = append(invokeSpans, span)
+			if len(span.Links) == 0 {
+				root = span
+			}
+		case "lambdag.Task.Execute":
+			for _, attr := range span.Attributes {
+				if attr.Key == attribute.Key("lambdag.task_id") {
+					taskIDs = append(taskIDs, attr.Value.AsString())
+				}
+			}
+		}
+	}
+	require.Len(t, invokeSpans, 3)
+	require.True(t, root.SpanContext.IsValid())
+	require.Contains(t, dagRunCtx.TraceContext["traceparent"], root.SpanContext.SpanID().String())
+	for _, span := range invokeSpans {
+		require.False(t, span.Parent.IsValid(), "the invocation span is not a child of the ended root span")
+		if span.SpanContext.SpanID() == root.SpanContext.SpanID() {
+			continue
+		}
+		require.Len(t, span.Links, 1)
+		require.EqualValues(t, root.SpanContext.TraceID(), span.Links[0].SpanContext.TraceID())
+		require.EqualValues(t, root.SpanContext.SpanID(), span.Links[0].SpanContext.SpanID())
+	}
+	require.EqualValues(t, []string{"task1", "task2", "task3"}, taskIDs)
+}
+
+func TestTracingShutdown(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	handled := make([]string, 0)
+	dag := newChainDAG(t, []string{"task1"}, &handled, lambdag.WithTraceExporter(exporter))
+	invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+	require.NoError(t, dag.Shutdown(context.Background()))
+	require.Empty(t, exporter.GetSpans(), "the exporter is shut down with the tracer provider")
+
+	_, span := dag.TracerProvider().Tracer("test").Start(context.Background(), "after shutdown")
+	require.False(t, span.SpanContext().IsValid())
+}
+
+func TestTracingTaskHandlerSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	dag, err := lambdag.NewDAG("test", lambdag.WithTraceExporter(exporter))
+	require.NoError(t, err)
+	_, err = dag.NewTask("task1", lambdag.TaskHandlerFunc(func(ctx context.Context, tr *lambdag.TaskRequest) (interface{}, error) {
+		_, span := dag.TracerProvider().Tracer("test").Start(ctx, "handler")
+		defer span.End()
+		return "task1 success", nil
+	}))
+	require.NoError(t, err)
+	invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{}`))
+
+	spansByName := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spansByName[span.Name] = span
+	}
+	require.EqualValues(t, spansByName["lambdag.Task.Execute"].SpanContext.SpanID(), spansByName["handler"].Parent.SpanID())
+	require.EqualValues(t, spansByName["lambdag.DAG.Execute"].SpanContext.SpanID(), spansByName["lambdag.Task.Execute"].Parent.SpanID())
+}
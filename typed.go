@@ -0,0 +1,64 @@
+package lambdag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// TypedTaskHandlerFunc is a TaskHandler which receives the DAG run config decoded into Config.
+type TypedTaskHandlerFunc[Config any, Out any] func(ctx context.Context, cfg Config, req *TaskRequest) (Out, error)
+
+func (h TypedTaskHandlerFunc[Config, Out]) Invoke(ctx context.Context, req *TaskRequest) (interface{}, error) {
+	cfg, err := DecodeDAGRunConfig[Config](req)
+	if err != nil {
+		return nil, err
+	}
+	return h(ctx, cfg, req)
+}
+
+// NewTypedTask creates a task with TypedTaskHandlerFunc.
+func NewTypedTask[Config any, Out any](dag *DAG, taskID string, fn func(ctx context.Context, cfg Config, req *TaskRequest) (Out, error), optFns ...func(opts *TaskOptions) error) (*Task, error) {
+	return dag.NewTask(taskID, TypedTaskHandlerFunc[Config, Out](fn), optFns...)
+}
+
+// DecodeDAGRunConfig decodes TaskRequest.DAGRunConfig into T. An empty config is decoded as the zero value.
+func DecodeDAGRunConfig[T any](req *TaskRequest) (T, error) {
+	var cfg T
+	if isEmptyJSON(req.DAGRunConfig) {
+		return cfg, nil
+	}
+	if err := json.Unmarshal(req.DAGRunConfig, &cfg); err != nil {
+		return cfg, &DAGRunConfigDecodeError{err: err}
+	}
+	return cfg, nil
+}
+
+// GetUpstreamResponse decodes the response of the upstream task into T with the ResponseCodec of the upstream task.
+func GetUpstreamResponse[T any](req *TaskRequest, taskID string) (T, error) {
+	var resp T
+	data, ok := req.TaskResponses[taskID]
+	if !ok {
+		return resp, &UpstreamResponseNotFoundError{TaskID: taskID}
+	}
+	if err := req.responseCodec(taskID).Decode(data, &resp); err != nil {
+		return resp, &UpstreamResponseDecodeError{TaskID: taskID, err: err}
+	}
+	return resp, nil
+}
+
+func isEmptyJSON(data json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+func (req *TaskRequest) responseCodec(taskID string) ResponseCodec {
+	if req.dag == nil {
+		return JSONCodec{}
+	}
+	task, ok := req.dag.GetTask(taskID)
+	if !ok {
+		return JSONCodec{}
+	}
+	return task.ResponseCodec()
+}
@@ -0,0 +1,63 @@
+package lambdag_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mashiike/lambdag"
+	"github.com/stretchr/testify/require"
+)
+
+type typedTestConfig struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type typedTestOutput struct {
+	Greeting string `json:"greeting"`
+	Count    int    `json:"count"`
+}
+
+func TestTypedTask(t *testing.T) {
+	dag, err := lambdag.NewDAG("TypedDAG")
+	require.NoError(t, err)
+	task1, err := lambdag.NewTypedTask(dag, "task1", func(ctx context.Context, cfg typedTestConfig, req *lambdag.TaskRequest) (*typedTestOutput, error) {
+		return &typedTestOutput{Greeting: "hello " + cfg.Name, Count: cfg.Count}, nil
+	})
+	require.NoError(t, err)
+	var received typedTestOutput
+	var notFoundErr, decodeErr error
+	task2, err := lambdag.NewTypedTask(dag, "task2", func(ctx context.Context, cfg typedTestConfig, req *lambdag.TaskRequest) (string, error) {
+		var err error
+		received, err = lambdag.GetUpstreamResponse[typedTestOutput](req, "task1")
+		if err != nil {
+			return "", err
+		}
+		_, notFoundErr = lambdag.GetUpstreamResponse[typedTestOutput](req, "unknown")
+		_, decodeErr = lambdag.GetUpstreamResponse[int](req, "task1")
+		return "ok", nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, task1.SetDownstream(task2))
+
+	invokeUntilEnd(t, lambdag.NewLambdaHandler(dag), []byte(`{"name":"lambdag","count":3}`))
+	require.EqualValues(t, typedTestOutput{Greeting: "hello lambdag", Count: 3}, received)
+	var nfe *lambdag.UpstreamResponseNotFoundError
+	require.True(t, errors.As(notFoundErr, &nfe))
+	require.EqualValues(t, "unknown", nfe.TaskID)
+	var de *lambdag.UpstreamResponseDecodeError
+	require.True(t, errors.As(decodeErr, &de))
+	require.EqualValues(t, "task1", de.TaskID)
+}
+
+func TestTypedTaskConfigDecodeError(t *testing.T) {
+	dag, err := lambdag.NewDAG("TypedDAG")
+	require.NoError(t, err)
+	_, err = lambdag.NewTypedTask(dag, "task1", func(ctx context.Context, cfg typedTestConfig, req *lambdag.TaskRequest) (string, error) {
+		return "ok", nil
+	})
+	require.NoError(t, err)
+	_, err = lambdag.NewLambdaHandler(dag).Invoke(context.Background(), []byte(`{"name":1}`))
+	require.ErrorContains(t, err, "DAG run config decode failed")
+}